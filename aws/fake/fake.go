@@ -0,0 +1,249 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/awslabs/operatorpkg/env"
+	"github.com/awslabs/operatorpkg/mock"
+	"github.com/awslabs/operatorpkg/option"
+)
+
+// Option configures the Fake
+type Option struct {
+	// GoldenDir is the directory of the golden files that responses are recorded to and replayed from
+	GoldenDir string
+	// Record sends requests to AWS and records the responses to the golden files, rather than faking them. It defaults
+	// to the AWS_FAKE_RECORD environment variable, e.g. AWS_FAKE_RECORD=true go test ./... Responses are merged into
+	// the existing golden files, so tests can create their own Fakes, but they must not record in parallel.
+	Record bool
+}
+
+func WithGoldenDir(dir string) func(*Option) {
+	return func(o *Option) {
+		o.GoldenDir = dir
+	}
+}
+
+func WithRecord(record bool) func(*Option) {
+	return func(o *Option) {
+		o.Record = record
+	}
+}
+
+// Fake intercepts the operations of AWS SDK clients and routes them to the mock.Functions registered for their
+// service and operation, e.g.
+//
+//	f := fake.New(fake.WithGoldenDir("testdata"))
+//	fake.Register(f, "EC2", "DescribeInstances", &describeInstances)
+//	ec2.NewFromConfig(awsConfig, func(o *ec2.Options) { o.APIOptions = append(o.APIOptions, f.Middleware) })
+//
+// Functions without an output or error replay the responses in the golden files, which are recorded by running the
+// tests against AWS with Record enabled.
+type Fake struct {
+	options  *Option
+	mu       sync.RWMutex
+	handlers map[operation]handler
+	// golden caches the calls of each golden file, which are updated while recording
+	golden map[operation][]call
+}
+
+type operation struct {
+	service string
+	name    string
+}
+
+type handler struct {
+	invoke func(input any) (any, error)
+	reset  func()
+}
+
+// call is a request and its response in a golden file
+type call struct {
+	Input  json.RawMessage `json:"input"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  *apiError       `json:"error,omitempty"`
+}
+
+// matches returns true if the call was made with the input. Golden files are indented, so inputs are compared
+// without whitespace.
+func (c call) matches(input json.RawMessage) bool {
+	recorded, actual := &bytes.Buffer{}, &bytes.Buffer{}
+	if json.Compact(recorded, c.Input) != nil || json.Compact(actual, input) != nil {
+		return false
+	}
+	return bytes.Equal(recorded.Bytes(), actual.Bytes())
+}
+
+// apiError is the serializable representation of an AWS error, which is replayed as a smithy.GenericAPIError
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message,omitempty"`
+	Fault   smithy.ErrorFault `json:"fault,omitempty"`
+}
+
+func New(opts ...option.Function[Option]) *Fake {
+	o := option.Resolve(append([]option.Function[Option]{WithRecord(env.WithDefaultBool("AWS_FAKE_RECORD", false))}, opts...)...)
+	return &Fake{options: o, handlers: map[operation]handler{}, golden: map[operation][]call{}}
+}
+
+// Register routes the operation of the service to the function, e.g. Register(f, "EC2", "DescribeInstances", fn).
+// The service is the service ID of the AWS SDK client, and the input and output are the operation's types. The function
+// is invoked without the context of the call, so it isn't interrupted when the context is canceled.
+func Register[I any, O any](f *Fake, service, name string, fn *mock.Function[I, O]) {
+	op := operation{service: service, name: name}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[op] = handler{
+		invoke: func(input any) (any, error) {
+			in, ok := input.(*I)
+			if !ok {
+				return nil, fmt.Errorf("expected input of %s/%s to be %T, got %T", service, name, in, input)
+			}
+			return fn.Invoke(in, func(in *I) (*O, error) { return replay[I, O](f, op, in) })
+		},
+		reset: fn.Reset,
+	}
+}
+
+// Reset resets the registered functions. It must be called between tests otherwise tests will pollute each other.
+func (f *Fake) Reset() {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, h := range f.handlers {
+		h.reset()
+	}
+}
+
+// Middleware intercepts the operations of the client and must be added to the client's APIOptions. It's added at the
+// end of the Initialize step, so input validation still runs, and intercepted operations never resolve credentials or
+// endpoints.
+func (f *Fake) Middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Fake", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		op := operation{service: middleware.GetServiceID(ctx), name: middleware.GetOperationName(ctx)}
+		if f.options.Record {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			if recordErr := f.record(op, in.Parameters, out.Result, err); recordErr != nil {
+				return out, metadata, fmt.Errorf("recording %s/%s, %w", op.service, op.name, recordErr)
+			}
+			return out, metadata, err
+		}
+		f.mu.RLock()
+		h, ok := f.handlers[op]
+		f.mu.RUnlock()
+		if !ok {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("no fake registered for %s/%s", op.service, op.name)
+		}
+		result, err := h.invoke(in.Parameters)
+		return middleware.InitializeOutput{Result: result}, middleware.Metadata{}, err
+	}), middleware.After)
+}
+
+// replay returns the response of the first call in the golden file with the same input
+func replay[I any, O any](f *Fake, op operation, input *I) (*O, error) {
+	calls, err := f.load(op)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("encoding input, %w", err)
+	}
+	for _, c := range calls {
+		if !c.matches(raw) {
+			continue
+		}
+		if c.Error != nil {
+			return nil, &smithy.GenericAPIError{Code: c.Error.Code, Message: c.Error.Message, Fault: c.Error.Fault}
+		}
+		out := new(O)
+		if err := json.Unmarshal(c.Output, out); err != nil {
+			return nil, fmt.Errorf("decoding output, %w", err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("no response recorded for %s/%s with input %s", op.service, op.name, raw)
+}
+
+// record adds the call to the golden file of the operation, replacing the recorded call with the same input. Calls
+// that were recorded by earlier tests, or by other Fakes, are kept.
+func (f *Fake) record(op operation, input any, output any, err error) error {
+	c := call{}
+	var marshalErr error
+	if c.Input, marshalErr = json.Marshal(input); marshalErr != nil {
+		return marshalErr
+	}
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		c.Error = &apiError{Code: apiErr.ErrorCode(), Message: apiErr.ErrorMessage(), Fault: apiErr.ErrorFault()}
+	case err != nil:
+		// Errors that didn't come from AWS, e.g. network errors, aren't worth replaying
+		return nil
+	default:
+		if c.Output, marshalErr = json.Marshal(output); marshalErr != nil {
+			return marshalErr
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls, loadErr := f.calls(op)
+	if loadErr != nil {
+		return loadErr
+	}
+	if i := slices.IndexFunc(calls, func(recorded call) bool { return recorded.matches(c.Input) }); i >= 0 {
+		calls[i] = c
+	} else {
+		calls = append(calls, c)
+	}
+	f.golden[op] = calls
+	data, marshalErr := json.MarshalIndent(f.golden[op], "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path(op)), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(f.path(op), append(data, '\n'), 0o644)
+}
+
+// load returns the calls of the golden file of the operation, or no calls if it doesn't exist
+func (f *Fake) load(op operation) ([]call, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls(op)
+}
+
+// calls returns the cached calls of the golden file of the operation, reading the file if they aren't cached. The
+// caller must hold the lock.
+func (f *Fake) calls(op operation) ([]call, error) {
+	if calls, ok := f.golden[op]; ok {
+		return calls, nil
+	}
+	var calls []call
+	data, err := os.ReadFile(f.path(op))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading golden file, %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &calls); err != nil {
+			return nil, fmt.Errorf("decoding golden file %s, %w", f.path(op), err)
+		}
+	}
+	f.golden[op] = calls
+	return calls, nil
+}
+
+// path returns the golden file of the operation, e.g. testdata/EC2/DescribeInstances.json
+func (f *Fake) path(op operation) string {
+	return filepath.Join(f.options.GoldenDir, op.service, op.name+".json")
+}
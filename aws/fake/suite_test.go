@@ -0,0 +1,143 @@
+package fake_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/awslabs/operatorpkg/aws/fake"
+	"github.com/awslabs/operatorpkg/mock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+)
+
+type DescribeWidgetsInput struct {
+	Name *string
+}
+
+type DescribeWidgetsOutput struct {
+	Widgets []string
+}
+
+var ctx context.Context
+var describeWidgets mock.Function[DescribeWidgetsInput, DescribeWidgetsOutput]
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AWS Fake")
+}
+
+var _ = BeforeEach(func() {
+	ctx = context.Background()
+	describeWidgets.Reset()
+})
+
+// invoke calls the operation through a stack with the fake and the options under test
+func invoke(ctx context.Context, f *fake.Fake, service, operation string, input any, optFns ...func(*middleware.Stack) error) (any, error) {
+	stack := middleware.NewStack(operation, func() interface{} { return struct{}{} })
+	lo.Must0(f.Middleware(stack))
+	for _, fn := range optFns {
+		lo.Must0(fn(stack))
+	}
+	ctx = middleware.WithServiceID(middleware.ClearStackValues(ctx), service)
+	ctx = middleware.WithOperationName(ctx, operation)
+	out, _, err := middleware.DecorateHandler(middleware.HandlerFunc(func(ctx context.Context, _ interface{}) (interface{}, middleware.Metadata, error) {
+		return nil, middleware.Metadata{}, nil
+	}), stack).Handle(ctx, input)
+	return out, err
+}
+
+// aws stands in for AWS when recording, by returning the widget with the name of the input, or a WidgetNotFound error
+// for inputs without a name
+func aws(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AWS", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		input := in.Parameters.(*DescribeWidgetsInput)
+		if input.Name == nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, &smithy.GenericAPIError{Code: "WidgetNotFound", Message: "widget not found", Fault: smithy.FaultClient}
+		}
+		return middleware.InitializeOutput{Result: &DescribeWidgetsOutput{Widgets: []string{*input.Name}}}, middleware.Metadata{}, nil
+	}), middleware.After)
+}
+
+var _ = Describe("Fake", func() {
+	var f *fake.Fake
+	BeforeEach(func() {
+		f = fake.New(fake.WithGoldenDir(GinkgoT().TempDir()))
+		fake.Register(f, "Widgets", "DescribeWidgets", &describeWidgets)
+	})
+
+	It("should route operations to the registered function", func() {
+		describeWidgets.Output.Set(&DescribeWidgetsOutput{Widgets: []string{"a", "b"}})
+		out, err := invoke(ctx, f, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{Name: lo.ToPtr("a")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal(&DescribeWidgetsOutput{Widgets: []string{"a", "b"}}))
+		Expect(describeWidgets.Calls()).To(Equal(1))
+		Expect(describeWidgets.CalledWithInput.Pop().Name).To(Equal(lo.ToPtr("a")))
+	})
+	It("should return the errors of the registered function", func() {
+		describeWidgets.Error.Set(errors.New("failed"))
+		_, err := invoke(ctx, f, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{})
+		Expect(err).To(MatchError("failed"))
+		Expect(describeWidgets.FailedCalls()).To(Equal(1))
+	})
+	It("should fail operations that aren't registered", func() {
+		_, err := invoke(ctx, f, "Widgets", "DeleteWidget", &DescribeWidgetsInput{})
+		Expect(err).To(MatchError(ContainSubstring("no fake registered for Widgets/DeleteWidget")))
+	})
+	It("should fail inputs of the wrong type", func() {
+		_, err := invoke(ctx, f, "Widgets", "DescribeWidgets", &DescribeWidgetsOutput{})
+		Expect(err).To(MatchError(ContainSubstring("expected input of Widgets/DescribeWidgets")))
+	})
+	It("should record responses and replay them", func() {
+		dir := GinkgoT().TempDir()
+		recorder := fake.New(fake.WithGoldenDir(dir), fake.WithRecord(true))
+		for _, input := range []*DescribeWidgetsInput{{Name: lo.ToPtr("a")}, {Name: lo.ToPtr("b")}, {}} {
+			_, _ = invoke(ctx, recorder, "Widgets", "DescribeWidgets", input, aws)
+		}
+		Expect(filepath.Join(dir, "Widgets", "DescribeWidgets.json")).To(BeAnExistingFile())
+
+		replayer := fake.New(fake.WithGoldenDir(dir))
+		fake.Register(replayer, "Widgets", "DescribeWidgets", &describeWidgets)
+		out, err := invoke(ctx, replayer, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{Name: lo.ToPtr("b")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal(&DescribeWidgetsOutput{Widgets: []string{"b"}}))
+
+		_, err = invoke(ctx, replayer, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{})
+		var apiErr smithy.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.ErrorCode()).To(Equal("WidgetNotFound"))
+
+		_, err = invoke(ctx, replayer, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{Name: lo.ToPtr("c")})
+		Expect(err).To(MatchError(ContainSubstring("no response recorded")))
+	})
+	It("should keep the recordings of other Fakes", func() {
+		dir := GinkgoT().TempDir()
+		for _, input := range []*DescribeWidgetsInput{{Name: lo.ToPtr("a")}, {Name: lo.ToPtr("b")}, {Name: lo.ToPtr("a")}} {
+			_, err := invoke(ctx, fake.New(fake.WithGoldenDir(dir), fake.WithRecord(true)), "Widgets", "DescribeWidgets", input, aws)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		var calls []any
+		Expect(json.Unmarshal(lo.Must(os.ReadFile(filepath.Join(dir, "Widgets", "DescribeWidgets.json"))), &calls)).To(Succeed())
+		Expect(calls).To(HaveLen(2))
+
+		replayer := fake.New(fake.WithGoldenDir(dir))
+		fake.Register(replayer, "Widgets", "DescribeWidgets", &describeWidgets)
+		for _, name := range []string{"a", "b"} {
+			out, err := invoke(ctx, replayer, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{Name: lo.ToPtr(name)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).To(Equal(&DescribeWidgetsOutput{Widgets: []string{name}}))
+		}
+	})
+	It("should prefer the output of the function to the golden file", func() {
+		describeWidgets.Output.Set(&DescribeWidgetsOutput{Widgets: []string{"mocked"}})
+		out, err := invoke(ctx, f, "Widgets", "DescribeWidgets", &DescribeWidgetsInput{Name: lo.ToPtr("a")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal(&DescribeWidgetsOutput{Widgets: []string{"mocked"}}))
+	})
+})
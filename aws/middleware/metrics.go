@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	pmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Metric labels are the structured error keys as label names, so that metrics and logs can be correlated
+const (
+	MetricSubsystem          = "aws_sdk"
+	MetricLabelServiceName   = "aws_service_name"
+	MetricLabelOperationName = "aws_operation_name"
+	MetricLabelErrorCode     = "aws_error_code"
+)
+
+// Metrics are the metrics recorded by NewMetricsHandler, which can be backed by any of the operatorpkg metrics, e.g.
+// Prometheus or EMF
+type Metrics struct {
+	// Duration observes the latency of calls in seconds, including retries
+	Duration pmetrics.ObservationMetric
+	// AttemptsTotal counts the attempts of calls
+	AttemptsTotal pmetrics.CounterMetric
+	// RetriesTotal counts the attempts that were retried
+	RetriesTotal pmetrics.CounterMetric
+	// ThrottlesTotal counts the attempts that were throttled
+	ThrottlesTotal pmetrics.CounterMetric
+	// ErrorsTotal counts the calls that failed, labeled by error code
+	ErrorsTotal pmetrics.CounterMetric
+}
+
+// Cardinality is limited to # services * # operations
+var Duration = pmetrics.NewPrometheusHistogram(
+	crmetrics.Registry,
+	prometheus.HistogramOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "call_duration_seconds",
+		Help:      "The latency of AWS SDK calls, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	},
+	[]string{MetricLabelServiceName, MetricLabelOperationName},
+)
+
+// Cardinality is limited to # services * # operations
+var AttemptsTotal = pmetrics.NewPrometheusCounter(
+	crmetrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "attempts_total",
+		Help:      "The number of attempts of AWS SDK calls. e.g. Attempts per call := attempts_total / call_duration_seconds_count",
+	},
+	[]string{MetricLabelServiceName, MetricLabelOperationName},
+)
+
+// Cardinality is limited to # services * # operations
+var RetriesTotal = pmetrics.NewPrometheusCounter(
+	crmetrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "retries_total",
+		Help:      "The number of attempts of AWS SDK calls that were retried.",
+	},
+	[]string{MetricLabelServiceName, MetricLabelOperationName},
+)
+
+// Cardinality is limited to # services * # operations
+var ThrottlesTotal = pmetrics.NewPrometheusCounter(
+	crmetrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "throttles_total",
+		Help:      "The number of attempts of AWS SDK calls that were throttled.",
+	},
+	[]string{MetricLabelServiceName, MetricLabelOperationName},
+)
+
+// Cardinality is limited to # services * # operations * # error codes
+var ErrorsTotal = pmetrics.NewPrometheusCounter(
+	crmetrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "errors_total",
+		Help:      "The number of AWS SDK calls that failed after retries, labeled by error code.",
+	},
+	[]string{MetricLabelServiceName, MetricLabelOperationName, MetricLabelErrorCode},
+)
+
+// MetricsHandler records the Prometheus metrics of every call, e.g. awsConfig.APIOptions = append(awsConfig.APIOptions,
+// middleware.MetricsHandler, middleware.StructuredErrorHandler)
+var MetricsHandler = NewMetricsHandler(Metrics{
+	Duration:       Duration,
+	AttemptsTotal:  AttemptsTotal,
+	RetriesTotal:   RetriesTotal,
+	ThrottlesTotal: ThrottlesTotal,
+	ErrorsTotal:    ErrorsTotal,
+})
+
+// NewMetricsHandler records the latency, attempts, retries, throttles and errors of every call. It runs first in the
+// Initialize step, so it observes the call as a whole, and reads the attempts from the results of the retry middleware.
+func NewMetricsHandler(m Metrics) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("MetricsHandler", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			labels := map[string]string{
+				MetricLabelServiceName:   middleware.GetServiceID(ctx),
+				MetricLabelOperationName: middleware.GetOperationName(ctx),
+			}
+			m.Duration.Observe(time.Since(start).Seconds(), labels)
+
+			// Calls without the retry middleware are a single attempt
+			attempts := []retry.AttemptResult{{Err: err}}
+			if results, ok := retry.GetAttemptResults(metadata); ok && len(results.Results) > 0 {
+				attempts = results.Results
+			}
+			m.AttemptsTotal.Add(float64(len(attempts)), labels)
+			for _, attempt := range attempts {
+				if attempt.Retried {
+					m.RetriesTotal.Inc(labels)
+				}
+				if attempt.Err != nil && throttled(attempt.Err) {
+					m.ThrottlesTotal.Inc(labels)
+				}
+			}
+			if err != nil {
+				m.ErrorsTotal.Inc(map[string]string{
+					MetricLabelServiceName:   labels[MetricLabelServiceName],
+					MetricLabelOperationName: labels[MetricLabelOperationName],
+					MetricLabelErrorCode:     errorCode(err),
+				})
+			}
+			return out, metadata, err
+		}), middleware.Before)
+	}
+}
+
+// errorCode returns the error code of the AWS error, or "Unknown" for errors without one, e.g. network errors
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return apiErr.ErrorCode()
+	}
+	return "Unknown"
+}
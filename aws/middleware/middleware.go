@@ -3,11 +3,14 @@ package middleware
 import (
 	"context"
 	"errors"
+	nethttp "net/http"
 
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
 	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/samber/lo"
 )
 
 const (
@@ -16,6 +19,12 @@ const (
 	AWSServiceNameLogKey   = "aws-service-name"
 	AWSOperationNameLogKey = "aws-operation-name"
 	AWSErrorCodeLogKey     = "aws-error-code"
+	AWSDurationLogKey      = "aws-duration"
+
+	AWSAttemptsLogKey           = "aws-attempts"
+	AWSRetryDelayLogKey         = "aws-retry-delay"
+	AWSRetryQuotaExceededLogKey = "aws-retry-quota-exceeded"
+	AWSRetryAfterLogKey         = "aws-retry-after"
 )
 
 // StructuredErrorHandler injects structured keys and values into the error returned by the AWS request
@@ -40,3 +49,13 @@ var StructuredErrorHandler = func(stack *middleware.Stack) error {
 		return out, metadata, serrors.Wrap(err, values...)
 	}), middleware.Before)
 }
+
+// throttled returns true if the AWS error was throttled, either by its error code or its HTTP status code
+func throttled(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && lo.HasKey(retry.DefaultThrottleErrorCodes, apiErr.ErrorCode()) {
+		return true
+	}
+	var respErr *http.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == nethttp.StatusTooManyRequests
+}
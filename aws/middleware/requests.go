@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Request is an AWS request that was made with a context that has a Collector
+type Request struct {
+	Service    string
+	Operation  string
+	RequestID  string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// KeysAndValues returns the request with the same keys as StructuredErrorHandler, for logging
+func (r Request) KeysAndValues() []any {
+	values := []any{AWSServiceNameLogKey, r.Service, AWSOperationNameLogKey, r.Operation, AWSRequestIDLogKey, r.RequestID}
+	if r.StatusCode != 0 {
+		values = append(values, AWSStatusCodeLogKey, r.StatusCode)
+	}
+	if r.Err != nil {
+		values = append(values, AWSErrorCodeLogKey, errorCode(r.Err))
+	}
+	return append(values, AWSDurationLogKey, r.Duration)
+}
+
+// Collector collects the AWS requests made with a context, e.g. during a reconcile. It's safe for concurrent use, so
+// requests can be made in parallel with the same context.
+type Collector struct {
+	mu       sync.Mutex
+	requests []Request
+}
+
+type collectorKey struct{}
+
+// WithCollector returns a context that collects the AWS requests that are made with it, or its children
+func WithCollector(ctx context.Context) (context.Context, *Collector) {
+	c := &Collector{}
+	return context.WithValue(ctx, collectorKey{}, c), c
+}
+
+// CollectorFromContext returns the collector of the context, or nil if it doesn't have one
+func CollectorFromContext(ctx context.Context) *Collector {
+	c, _ := ctx.Value(collectorKey{}).(*Collector)
+	return c
+}
+
+// Requests returns the requests that were collected, in the order they completed
+func (c *Collector) Requests() []Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.requests)
+}
+
+// Log logs every collected request as a debug message
+func (c *Collector) Log(logger logr.Logger) {
+	for _, r := range c.Requests() {
+		logger.V(1).Info("made aws request", r.KeysAndValues()...)
+	}
+}
+
+func (c *Collector) add(r Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r)
+}
+
+// RequestHandler records the service, operation, request ID, status code and duration of every request, including
+// successful ones, in the Collector of the request's context. Requests made with contexts without a collector aren't
+// recorded.
+var RequestHandler = func(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RequestHandler", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		collector := CollectorFromContext(ctx)
+		if collector == nil {
+			return next.HandleInitialize(ctx, in)
+		}
+		start := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		r := Request{
+			Service:   middleware.GetServiceID(ctx),
+			Operation: middleware.GetOperationName(ctx),
+			Duration:  time.Since(start),
+			Err:       err,
+		}
+		r.RequestID, _ = awsmiddleware.GetRequestIDMetadata(metadata)
+		if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+			r.StatusCode = resp.StatusCode
+		}
+		var respErr *http.ResponseError
+		if errors.As(err, &respErr) {
+			r.RequestID, r.StatusCode = respErr.RequestID, respErr.HTTPStatusCode()
+		}
+		collector.add(r)
+		return out, metadata, err
+	}), middleware.Before)
+}
+
+// LogRequests wraps a reconciler so that the AWS requests made during each reconcile are logged as debug messages with
+// the reconcile's logger, once the reconcile completes
+func LogRequests(reconciler reconcile.Reconciler) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		ctx, collector := WithCollector(ctx)
+		defer collector.Log(log.FromContext(ctx))
+		return reconciler.Reconcile(ctx, req)
+	})
+}
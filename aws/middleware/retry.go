@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/awslabs/operatorpkg/serrors"
+)
+
+// Option configures the RetryHandler
+type Option struct {
+	// ThrottledRetryAfter is the minimum delay that throttled errors suggest before the reconciler retries
+	ThrottledRetryAfter time.Duration
+}
+
+func WithThrottledRetryAfter(d time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.ThrottledRetryAfter = d
+	}
+}
+
+// RetryHandler annotates errors with the retries of the AWS request, using a throttled retry-after of 5 seconds
+var RetryHandler = NewRetryHandler()
+
+// NewRetryHandler annotates the error returned by the AWS request with the number of attempts, the total delay between
+// attempts, and whether the retryer ran out of retry tokens. The delay includes both the backoff of the retryer and
+// the time that the adaptive retryer waited for its client side rate limit. Throttled errors suggest a delay before
+// the reconciler retries, at least ThrottledRetryAfter or the delay between attempts, whichever is longer, which is
+// honored by reasonable.RetryAfterRateLimiter so that controllers back off rather than immediately calling AWS again.
+// The retry middleware of the stack must be added before the RetryHandler.
+func NewRetryHandler(opts ...option.Function[Option]) func(*middleware.Stack) error {
+	options := option.Resolve(opts...)
+	if options.ThrottledRetryAfter <= 0 {
+		options.ThrottledRetryAfter = 5 * time.Second
+	}
+	return func(stack *middleware.Stack) error {
+		if err := stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("RetryHandler", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			attempts := &attempts{}
+			out, metadata, err := next.HandleFinalize(context.WithValue(ctx, attemptsKey{}, attempts), in)
+			if err == nil {
+				return out, metadata, nil
+			}
+			delay := attempts.delay()
+			values := []any{AWSAttemptsLogKey, len(attempts.starts), AWSRetryDelayLogKey, delay}
+			if quotaExceeded(err) {
+				values = append(values, AWSRetryQuotaExceededLogKey, true)
+			}
+			if throttled(err) {
+				retryAfter := max(options.ThrottledRetryAfter, delay)
+				values = append(values, AWSRetryAfterLogKey, retryAfter)
+				err = &throttledError{error: err, retryAfter: retryAfter}
+			}
+			return out, metadata, serrors.Wrap(err, values...)
+		}), "Retry", middleware.Before); err != nil {
+			return err
+		}
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("RetryAttemptHandler", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			attempts, ok := ctx.Value(attemptsKey{}).(*attempts)
+			if !ok {
+				return next.HandleFinalize(ctx, in)
+			}
+			attempts.starts = append(attempts.starts, time.Now())
+			defer func() { attempts.ends = append(attempts.ends, time.Now()) }()
+			return next.HandleFinalize(ctx, in)
+		}), "Retry", middleware.After)
+	}
+}
+
+type attemptsKey struct{}
+
+// attempts records when each attempt started and ended. Attempts are made sequentially by the retry middleware, so
+// they don't need to be synchronized.
+type attempts struct {
+	starts []time.Time
+	ends   []time.Time
+}
+
+// delay returns the total time between the end of an attempt and the start of the next
+func (a *attempts) delay() (delay time.Duration) {
+	for i := 1; i < len(a.starts) && i <= len(a.ends); i++ {
+		delay += a.starts[i].Sub(a.ends[i-1])
+	}
+	return delay
+}
+
+// quotaExceeded returns true if the retryer ran out of retry tokens, or the adaptive retryer ran out of attempt tokens
+// and is configured to fail rather than wait for them
+func quotaExceeded(err error) bool {
+	return errors.As(err, &ratelimit.QuotaExceededError{}) || strings.Contains(err.Error(), "unable to get attempt token")
+}
+
+// throttledError suggests a delay before retrying a throttled request, see reasonable.RetryAfter
+type throttledError struct {
+	error
+	retryAfter time.Duration
+}
+
+func (e *throttledError) Unwrap() error {
+	return e.error
+}
+
+func (e *throttledError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
@@ -0,0 +1,342 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithymiddleware "github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/awslabs/operatorpkg/aws/middleware"
+	"github.com/awslabs/operatorpkg/serrors"
+	. "github.com/awslabs/operatorpkg/test/expectations"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var ctx context.Context
+var server *httptest.Server
+var responses []response
+var mu sync.Mutex
+
+// response is returned by the server for a request, with an error code if the status code isn't 200
+type response struct {
+	statusCode int
+	errorCode  string
+}
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AWS Middleware")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = context.Background()
+	server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		resp := response{statusCode: nethttp.StatusOK}
+		if len(responses) > 0 {
+			resp, responses = responses[0], responses[1:]
+		}
+		w.Header().Set("X-Amzn-Requestid", fmt.Sprintf("request-%d", len(responses)))
+		w.Header().Set("X-Amzn-Errortype", resp.errorCode)
+		w.WriteHeader(resp.statusCode)
+	}))
+	DeferCleanup(server.Close)
+})
+
+var _ = BeforeEach(func() {
+	respond()
+	middleware.Duration.Reset()
+	middleware.AttemptsTotal.Reset()
+	middleware.RetriesTotal.Reset()
+	middleware.ThrottlesTotal.Reset()
+	middleware.ErrorsTotal.Reset()
+})
+
+// respond sets the responses that the server returns in order, after which it returns 200
+func respond(r ...response) {
+	mu.Lock()
+	defer mu.Unlock()
+	responses = r
+}
+
+// invoke calls the operation of the service through a stack that is assembled like the stacks of the AWS SDK clients,
+// with a standard retryer that doesn't back off, the server as the endpoint, and the options under test
+func invoke(ctx context.Context, service, operation string, optFns ...func(*smithymiddleware.Stack) error) (smithymiddleware.Metadata, error) {
+	stack := smithymiddleware.NewStack(operation, smithyhttp.NewStackRequest)
+	lo.Must0(stack.Serialize.Add(smithymiddleware.SerializeMiddlewareFunc("OperationSerializer", func(ctx context.Context, in smithymiddleware.SerializeInput, next smithymiddleware.SerializeHandler) (smithymiddleware.SerializeOutput, smithymiddleware.Metadata, error) {
+		req := in.Request.(*smithyhttp.Request)
+		req.URL = lo.Must(url.Parse(server.URL + "/" + operation))
+		req.Method = nethttp.MethodPost
+		return next.HandleSerialize(ctx, in)
+	}), smithymiddleware.After))
+	lo.Must0(stack.Finalize.Add(smithymiddleware.FinalizeMiddlewareFunc("Signing", func(ctx context.Context, in smithymiddleware.FinalizeInput, next smithymiddleware.FinalizeHandler) (smithymiddleware.FinalizeOutput, smithymiddleware.Metadata, error) {
+		return next.HandleFinalize(ctx, in)
+	}), smithymiddleware.After))
+	lo.Must0(retry.AddRetryMiddlewares(stack, retry.AddRetryMiddlewaresOptions{Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+		o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+	})}))
+	lo.Must0(stack.Deserialize.Add(smithymiddleware.DeserializeMiddlewareFunc("OperationDeserializer", func(ctx context.Context, in smithymiddleware.DeserializeInput, next smithymiddleware.DeserializeHandler) (smithymiddleware.DeserializeOutput, smithymiddleware.Metadata, error) {
+		out, metadata, err := next.HandleDeserialize(ctx, in)
+		if err != nil {
+			return out, metadata, err
+		}
+		resp := out.RawResponse.(*smithyhttp.Response)
+		defer resp.Body.Close()
+		if resp.StatusCode != nethttp.StatusOK {
+			return out, metadata, &smithyhttp.ResponseError{Response: resp, Err: &smithy.GenericAPIError{
+				Code:  resp.Header.Get("X-Amzn-Errortype"),
+				Fault: lo.Ternary(resp.StatusCode >= nethttp.StatusInternalServerError, smithy.FaultServer, smithy.FaultClient),
+			}}
+		}
+		return out, metadata, nil
+	}), smithymiddleware.After))
+	lo.Must0(awsmiddleware.AddRequestIDRetrieverMiddleware(stack))
+	lo.Must0(awshttp.AddResponseErrorMiddleware(stack))
+	lo.Must0(awsmiddleware.AddRawResponseToMetadata(stack))
+	for _, fn := range optFns {
+		lo.Must0(fn(stack))
+	}
+	ctx = smithymiddleware.WithServiceID(smithymiddleware.ClearStackValues(ctx), service)
+	ctx = smithymiddleware.WithOperationName(ctx, operation)
+	_, metadata, err := smithymiddleware.DecorateHandler(smithyhttp.NewClientHandler(server.Client()), stack).Handle(ctx, struct{}{})
+	return metadata, err
+}
+
+// withRetryer replaces the retryer of the stack
+func withRetryer(retryer aws.Retryer) func(*smithymiddleware.Stack) error {
+	return func(stack *smithymiddleware.Stack) error {
+		_, err := stack.Finalize.Swap("Retry", retry.NewAttemptMiddleware(retryer, smithyhttp.RequestCloner))
+		return err
+	}
+}
+
+var _ = Describe("StructuredErrorHandler", func() {
+	It("should add the service, operation, request ID, status and error code", func() {
+		respond(response{statusCode: nethttp.StatusNotFound, errorCode: "InvalidInstanceID.NotFound"})
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.StructuredErrorHandler)
+		Expect(err).To(HaveOccurred())
+		Expect(valuesOf(err)).To(Equal(map[string]any{
+			middleware.AWSServiceNameLogKey:   "EC2",
+			middleware.AWSOperationNameLogKey: "DescribeInstances",
+			middleware.AWSRequestIDLogKey:     "request-0",
+			middleware.AWSStatusCodeLogKey:    nethttp.StatusNotFound,
+			middleware.AWSErrorCodeLogKey:     "InvalidInstanceID.NotFound",
+		}))
+	})
+})
+
+var _ = Describe("MetricsHandler", func() {
+	labels := map[string]string{middleware.MetricLabelServiceName: "EC2", middleware.MetricLabelOperationName: "DescribeInstances"}
+
+	It("should record successful calls", func() {
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.MetricsHandler)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(GetMetric("operator_aws_sdk_call_duration_seconds", labels).GetHistogram().GetSampleCount()).To(BeNumerically("==", 1))
+		Expect(GetMetric("operator_aws_sdk_attempts_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 1))
+		Expect(GetMetric("operator_aws_sdk_retries_total", labels)).To(BeNil())
+		Expect(GetMetric("operator_aws_sdk_errors_total", labels)).To(BeNil())
+	})
+	It("should record retries and throttles", func() {
+		respond(
+			response{statusCode: nethttp.StatusBadRequest, errorCode: "RequestLimitExceeded"},
+			response{statusCode: nethttp.StatusServiceUnavailable, errorCode: "ServiceUnavailable"},
+		)
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.MetricsHandler)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(GetMetric("operator_aws_sdk_attempts_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 3))
+		Expect(GetMetric("operator_aws_sdk_retries_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 2))
+		Expect(GetMetric("operator_aws_sdk_throttles_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 1))
+		Expect(GetMetric("operator_aws_sdk_errors_total", labels)).To(BeNil())
+	})
+	It("should record errors by error code", func() {
+		respond(response{statusCode: nethttp.StatusBadRequest, errorCode: "InvalidParameterValue"})
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.MetricsHandler, middleware.StructuredErrorHandler)
+		Expect(err).To(HaveOccurred())
+		Expect(GetMetric("operator_aws_sdk_attempts_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 1))
+		Expect(GetMetric("operator_aws_sdk_errors_total", lo.Assign(labels, map[string]string{middleware.MetricLabelErrorCode: "InvalidParameterValue"})).GetCounter().GetValue()).To(BeNumerically("==", 1))
+	})
+	It("should record failed calls that exhausted their attempts", func() {
+		respond(
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+		)
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.MetricsHandler)
+		Expect(err).To(HaveOccurred())
+		Expect(GetMetric("operator_aws_sdk_attempts_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 3))
+		Expect(GetMetric("operator_aws_sdk_retries_total", labels).GetCounter().GetValue()).To(BeNumerically("==", 2))
+		Expect(GetMetric("operator_aws_sdk_errors_total", lo.Assign(labels, map[string]string{middleware.MetricLabelErrorCode: "InternalError"})).GetCounter().GetValue()).To(BeNumerically("==", 1))
+	})
+	It("should record metrics with any of the operatorpkg metrics", func() {
+		counter := &fakeCounter{}
+		handler := middleware.NewMetricsHandler(middleware.Metrics{
+			Duration:       middleware.Duration,
+			AttemptsTotal:  counter,
+			RetriesTotal:   middleware.RetriesTotal,
+			ThrottlesTotal: middleware.ThrottlesTotal,
+			ErrorsTotal:    middleware.ErrorsTotal,
+		})
+		_, err := invoke(ctx, "EC2", "DescribeInstances", handler)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counter.values).To(HaveKeyWithValue("EC2/DescribeInstances", float64(1)))
+	})
+})
+
+var _ = Describe("RetryHandler", func() {
+	backoff := func(o *retry.StandardOptions) {
+		o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 10 * time.Millisecond, nil })
+	}
+
+	It("should add the attempts and retry delay", func() {
+		respond(
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+		)
+		_, err := invoke(ctx, "EC2", "DescribeInstances", withRetryer(retry.NewStandard(backoff)), middleware.RetryHandler)
+		Expect(err).To(HaveOccurred())
+		values := valuesOf(err)
+		Expect(values).To(HaveKeyWithValue(middleware.AWSAttemptsLogKey, 3))
+		Expect(values).To(HaveKeyWithValue(middleware.AWSRetryDelayLogKey, BeNumerically(">=", 20*time.Millisecond)))
+		Expect(values).ToNot(HaveKey(middleware.AWSRetryQuotaExceededLogKey))
+		Expect(values).ToNot(HaveKey(middleware.AWSRetryAfterLogKey))
+		Expect(errors.As(err, new(retryAfterError))).To(BeFalse())
+	})
+	It("should not annotate successful requests", func() {
+		respond(response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"})
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.RetryHandler)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("should add whether the retry quota was exceeded", func() {
+		respond(
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+			response{statusCode: nethttp.StatusInternalServerError, errorCode: "InternalError"},
+		)
+		retryer := retry.NewStandard(backoff, func(o *retry.StandardOptions) {
+			o.RateLimiter = ratelimit.NewTokenRateLimit(5)
+		})
+		_, err := invoke(ctx, "EC2", "DescribeInstances", withRetryer(retryer), middleware.RetryHandler)
+		Expect(err).To(HaveOccurred())
+		values := valuesOf(err)
+		// The bucket only has tokens for the first retry
+		Expect(values).To(HaveKeyWithValue(middleware.AWSAttemptsLogKey, 2))
+		Expect(values).To(HaveKeyWithValue(middleware.AWSRetryQuotaExceededLogKey, true))
+	})
+	It("should suggest a retry-after for throttled requests", func() {
+		respond(
+			response{statusCode: nethttp.StatusBadRequest, errorCode: "RequestLimitExceeded"},
+			response{statusCode: nethttp.StatusBadRequest, errorCode: "RequestLimitExceeded"},
+			response{statusCode: nethttp.StatusBadRequest, errorCode: "RequestLimitExceeded"},
+		)
+		_, err := invoke(ctx, "EC2", "DescribeInstances", withRetryer(retry.NewStandard(backoff)), middleware.NewRetryHandler(middleware.WithThrottledRetryAfter(time.Minute)), middleware.StructuredErrorHandler)
+		Expect(err).To(HaveOccurred())
+		Expect(valuesOf(err)).To(HaveKeyWithValue(middleware.AWSRetryAfterLogKey, time.Minute))
+		var retryAfter retryAfterError
+		Expect(errors.As(err, &retryAfter)).To(BeTrue())
+		Expect(retryAfter.RetryAfter()).To(Equal(time.Minute))
+	})
+	It("should suggest a retry-after for requests throttled by their status code", func() {
+		respond(
+			response{statusCode: nethttp.StatusTooManyRequests, errorCode: "Unrecognized"},
+			response{statusCode: nethttp.StatusTooManyRequests, errorCode: "Unrecognized"},
+			response{statusCode: nethttp.StatusTooManyRequests, errorCode: "Unrecognized"},
+		)
+		_, err := invoke(ctx, "EC2", "DescribeInstances", withRetryer(retry.NewStandard(backoff)), middleware.NewRetryHandler(middleware.WithThrottledRetryAfter(time.Minute)))
+		Expect(err).To(HaveOccurred())
+		Expect(valuesOf(err)).To(HaveKeyWithValue(middleware.AWSRetryAfterLogKey, time.Minute))
+	})
+})
+
+var _ = Describe("RequestHandler", func() {
+	It("should collect successful and failed requests", func() {
+		respond(response{statusCode: nethttp.StatusNotFound, errorCode: "InvalidInstanceID.NotFound"})
+		ctx, collector := middleware.WithCollector(ctx)
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.RequestHandler)
+		Expect(err).To(HaveOccurred())
+		_, err = invoke(ctx, "IAM", "GetInstanceProfile", middleware.RequestHandler)
+		Expect(err).ToNot(HaveOccurred())
+
+		requests := collector.Requests()
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0]).To(MatchFields(IgnoreExtras, Fields{
+			"Service":    Equal("EC2"),
+			"Operation":  Equal("DescribeInstances"),
+			"RequestID":  Equal("request-0"),
+			"StatusCode": Equal(nethttp.StatusNotFound),
+			"Err":        HaveOccurred(),
+		}))
+		Expect(requests[1]).To(MatchFields(IgnoreExtras, Fields{
+			"Service":    Equal("IAM"),
+			"Operation":  Equal("GetInstanceProfile"),
+			"RequestID":  Equal("request-0"),
+			"StatusCode": Equal(nethttp.StatusOK),
+			"Err":        BeNil(),
+		}))
+		Expect(requests[0].KeysAndValues()).To(ContainElements(
+			middleware.AWSRequestIDLogKey, "request-0",
+			middleware.AWSErrorCodeLogKey, "InvalidInstanceID.NotFound",
+		))
+	})
+	It("should not collect requests without a collector", func() {
+		_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.RequestHandler)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(middleware.CollectorFromContext(ctx)).To(BeNil())
+	})
+	It("should log the requests of a reconcile", func() {
+		var lines []string
+		logger := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{Verbosity: 1})
+		reconciler := middleware.LogRequests(reconcile.Func(func(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+			_, err := invoke(ctx, "EC2", "DescribeInstances", middleware.RequestHandler)
+			return reconcile.Result{}, err
+		}))
+		_, err := reconciler.Reconcile(log.IntoContext(ctx, logger), reconcile.Request{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(ContainSubstring(`"aws-request-id"="request-0"`))
+		Expect(lines[0]).To(ContainSubstring(`"aws-operation-name"="DescribeInstances"`))
+	})
+})
+
+// retryAfterError is the interface that reasonable.RetryAfterRateLimiter honors
+type retryAfterError interface {
+	RetryAfter() time.Duration
+}
+
+func valuesOf(err error) map[string]any {
+	return lo.SliceToMap(lo.Chunk(serrors.UnwrapValues(err), 2), func(kv []any) (string, any) { return kv[0].(string), kv[1] })
+}
+
+type fakeCounter struct {
+	values map[string]float64
+}
+
+func (c *fakeCounter) Inc(labels map[string]string) { c.Add(1, labels) }
+func (c *fakeCounter) Add(v float64, labels map[string]string) {
+	if c.values == nil {
+		c.values = map[string]float64{}
+	}
+	c.values[labels[middleware.MetricLabelServiceName]+"/"+labels[middleware.MetricLabelOperationName]] += v
+}
+func (c *fakeCounter) Delete(map[string]string)             {}
+func (c *fakeCounter) DeletePartialMatch(map[string]string) {}
+func (c *fakeCounter) Reset()                               {}
@@ -0,0 +1,157 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/go-logr/logr"
+	"github.com/samber/lo"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	clientleaderelection "k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+/*
+NewCoordinatedLock returns a lock that participates in coordinated leader election
+(https://kubernetes.io/docs/concepts/cluster-administration/coordinated-leader-election/). The candidate publishes a
+LeaseCandidate with its binary and emulation versions, and the control plane assigns the lease to the candidate with
+the oldest emulation version and the newest binary version, so that mixed-version rollouts elect the newest leader
+that every replica is compatible with.
+
+Clusters that don't serve LeaseCandidates fall back to classic lease election. Clusters can serve LeaseCandidates
+without running the controller that elects a leader from them, so if the lease still doesn't exist once the
+coordination timeout has passed, it's created the classic way too. Leases that aren't managed by the control plane,
+e.g. held by a replica from before the migration, are also acquired the classic way.
+
+The LeaseCandidate is renewed until the context is cancelled, so the context should outlive the manager.
+*/
+func NewCoordinatedLock(ctx context.Context, kubeClient kubernetes.Interface, namespace string, name string, binaryVersion string, emulationVersion string, opts ...option.Function[Option]) (*Lock, error) {
+	options := option.Resolve(opts...)
+	if options.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("getting hostname, %w", err)
+		}
+		// The identity names the LeaseCandidate, so it must be a valid DNS subdomain
+		options.Identity = fmt.Sprintf("%s-%s", strings.ToLower(hostname), uuid.NewUUID())
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, name, kubeClient.CoreV1(), kubeClient.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: options.Identity})
+	if err != nil {
+		return nil, fmt.Errorf("creating lease lock, %w", err)
+	}
+	supported, err := coordinatedLeaderElectionSupported(kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("discovering lease candidates, %w", err)
+	}
+	if !supported {
+		log.FromContext(ctx).Info("coordinated leader election isn't supported, falling back to lease election", "namespace", namespace, "name", name)
+		return NewLockFor(lock), nil
+	}
+	candidate, waiter, err := clientleaderelection.NewCandidate(kubeClient, namespace, options.Identity, name, binaryVersion, emulationVersion, coordinationv1.OldestEmulationVersion)
+	if err != nil {
+		return nil, fmt.Errorf("creating lease candidate, %w", err)
+	}
+	// The candidate starts its informers asynchronously, and the waiter only waits for informers that have started, so
+	// they're started here to make sure the wait covers them
+	if factory, ok := waiter.(interface{ Start(<-chan struct{}) }); ok {
+		factory.Start(ctx.Done())
+	}
+	go candidate.Run(ctx)
+	for informer, synced := range waiter.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("waiting for %s cache to sync", informer)
+		}
+	}
+	return NewLockFor(&coordinatedLock{
+		Interface: lock,
+		deadline:  time.Now().Add(lo.Ternary(options.CoordinationTimeout <= 0, time.Minute, options.CoordinationTimeout)),
+		logger:    log.FromContext(ctx).WithValues("namespace", namespace, "name", name),
+	}), nil
+}
+
+func coordinatedLeaderElectionSupported(kubeClient kubernetes.Interface) (bool, error) {
+	resources, err := kubeClient.Discovery().ServerResourcesForGroupVersion(coordinationv1beta1.SchemeGroupVersion.String())
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return lo.ContainsBy(resources.APIResources, func(r metav1.APIResource) bool { return r.Name == "leasecandidates" }), nil
+}
+
+// coordinatedLock prevents the leader elector from acquiring leases that are assigned by the control plane. The
+// elector only renews these leases once they're assigned to it, and stops renewing them when the control plane
+// prefers another candidate.
+type coordinatedLock struct {
+	resourcelock.Interface
+	// deadline is when the lock stops waiting for the control plane to create the lease
+	deadline time.Time
+	logger   logr.Logger
+
+	mu       sync.Mutex
+	observed *resourcelock.LeaderElectionRecord
+}
+
+func (c *coordinatedLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	record, raw, err := c.Interface.Get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observed = lo.ToPtr(*record)
+	return record, raw, nil
+}
+
+// Create is rejected since the control plane creates the lease once it elects a candidate. If the control plane
+// hasn't created it by the deadline, it isn't coordinating the election, so the lease is created the classic way.
+func (c *coordinatedLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if time.Now().Before(c.deadline) {
+		return fmt.Errorf("waiting for the control plane to elect a leader for %s", c.Describe())
+	}
+	c.logger.Info("control plane didn't elect a leader, falling back to lease election")
+	return c.Interface.Create(ctx, ler)
+}
+
+func (c *coordinatedLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	c.mu.Lock()
+	observed := c.observed
+	c.mu.Unlock()
+	if observed != nil && observed.Strategy != "" {
+		// The leader elector renews optimistically without getting the lease, so refresh it to notice when the control
+		// plane ends the term
+		record, _, err := c.Get(ctx)
+		if err != nil {
+			return err
+		}
+		observed = record
+		// Releasing the lease clears the holder, and handing it off sets another holder, but both require holding it
+		if ler.HolderIdentity != "" && observed.HolderIdentity != c.Identity() {
+			return fmt.Errorf("lease %s is assigned to %q by the control plane", c.Describe(), observed.HolderIdentity)
+		}
+		if ler.HolderIdentity == c.Identity() && observed.PreferredHolder != "" && observed.PreferredHolder != c.Identity() {
+			return fmt.Errorf("lease %s is ending its term, the control plane prefers %q", c.Describe(), observed.PreferredHolder)
+		}
+		// The classic leader elector doesn't carry the strategy over when it renews or releases the lease
+		ler.Strategy = observed.Strategy
+	}
+	if err := c.Interface.Update(ctx, ler); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observed = lo.ToPtr(ler)
+	return nil
+}
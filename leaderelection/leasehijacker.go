@@ -7,12 +7,14 @@ import (
 	"time"
 
 	"github.com/samber/lo"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/uuid"
-	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
-	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -22,10 +24,13 @@ When starting your controller manager, your local process will forcibly
 become leader. This is useful when developing locally against a cluster
 which already has a controller running in it
 
-TODO: migrate to https://kubernetes.io/docs/concepts/cluster-administration/coordinated-leader-election/ when it's past alpha.
+See NewCoordinatedLock for clusters that support coordinated leader election. The lock doesn't record leadership
+metrics unless it's wrapped with NewLockFor.
 
 Include this in your controller manager as follows:
 ```
+// Returns nil if HIJACK_LEASE is not set
+lock, err := leaderelection.LeaseHijacker(...)
 controllerruntime.NewManager(..., controllerruntime.Options{
 
 // Used if HIJACK_LEASE is not set
@@ -33,35 +38,87 @@ LeaderElectionID:                    name,
 LeaderElectionNamespace:             "namespace",
 
 // Used if HIJACK_LEASE=true
-LeaderElectionResourceLockInterface: leaderelection.LeaseHijacker(...)
+LeaderElectionResourceLockInterface: lock,
 }
 ```
 */
-func LeaseHijacker(ctx context.Context, config *rest.Config, namespace string, name string) resourcelock.Interface {
+func LeaseHijacker(ctx context.Context, config *rest.Config, namespace string, name string) (resourcelock.Interface, error) {
 	if os.Getenv("HIJACK_LEASE") != "true" {
-		return nil // If not set, fallback to other controller-runtime lease settings
+		return nil, nil // If not set, fallback to other controller-runtime lease settings
 	}
-	kubeClient := coordinationv1client.NewForConfigOrDie(config)
-	lease := lo.Must(kubeClient.Leases(namespace).Get(ctx, name, metav1.GetOptions{}))
-
-	untilElection := time.Until(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating kube client, %w", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("getting hostname, %w", err)
+	}
+	return HijackLease(ctx, kubeClient, namespace, name, fmt.Sprintf("%s_%s", hostname, uuid.NewUUID()))
+}
 
-	lease.Spec.HolderIdentity = lo.ToPtr(fmt.Sprintf("%s_%s", lo.Must(os.Hostname()), uuid.NewUUID()))
-	lease.Spec.AcquireTime = lo.ToPtr(metav1.NowMicro())
-	lease.Spec.RenewTime = lo.ToPtr(metav1.NowMicro())
-	*lease.Spec.LeaseDurationSeconds += 5 // Make our lease longer to guarantee we win the next election
-	*lease.Spec.LeaseTransitions += 1
-	lo.Must(kubeClient.Leases(namespace).Update(ctx, lease, metav1.UpdateOptions{}))
+// HijackLease takes over the lease for the identity, creating it if it doesn't exist, and waits until the previous
+// holder's lease would have expired so that the previous holder has stepped down.
+func HijackLease(ctx context.Context, kubeClient kubernetes.Interface, namespace string, name string, identity string) (resourcelock.Interface, error) {
+	var untilElection time.Duration
+	// The lease may be created or renewed by the current holder while we're hijacking it
+	if err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		lease, err := kubeClient.CoordinationV1().Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			untilElection = 0
+			_, err = kubeClient.CoordinationV1().Leases(namespace).Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+				Spec:       hijackedLeaseSpec(coordinationv1.LeaseSpec{}, identity),
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		untilElection = 0
+		if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+			untilElection = time.Until(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+		}
+		lease.Spec = hijackedLeaseSpec(lease.Spec, identity)
+		_, err = kubeClient.CoordinationV1().Leases(namespace).Update(ctx, lease, metav1.UpdateOptions{})
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("hijacking lease %s/%s, %w", namespace, name, err)
+	}
 
-	log.FromContext(ctx).Info(fmt.Sprintf("hijacked lease, waiting %s for election", untilElection), "namespace", namespace, "name", name)
-	time.Sleep(untilElection)
+	if untilElection > 0 {
+		log.FromContext(ctx).Info(fmt.Sprintf("hijacked lease, waiting %s for election", untilElection), "namespace", namespace, "name", name)
+		timer := time.NewTimer(untilElection)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for election, %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
 
-	return lo.Must(resourcelock.New(
+	lock, err := resourcelock.New(
 		resourcelock.LeasesResourceLock,
 		namespace,
 		name,
-		corev1client.NewForConfigOrDie(config),
-		coordinationv1client.NewForConfigOrDie(config),
-		resourcelock.ResourceLockConfig{Identity: *lease.Spec.HolderIdentity},
-	))
+		kubeClient.CoreV1(),
+		kubeClient.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating lease lock, %w", err)
+	}
+	return lock, nil
+}
+
+func hijackedLeaseSpec(spec coordinationv1.LeaseSpec, identity string) coordinationv1.LeaseSpec {
+	spec.HolderIdentity = lo.ToPtr(identity)
+	spec.AcquireTime = lo.ToPtr(metav1.NowMicro())
+	spec.RenewTime = lo.ToPtr(metav1.NowMicro())
+	// Make our lease longer to guarantee we win the next election
+	spec.LeaseDurationSeconds = lo.ToPtr(lo.FromPtrOr(spec.LeaseDurationSeconds, int32(LeaseDuration.Seconds())) + 5)
+	spec.LeaseTransitions = lo.ToPtr(lo.FromPtr(spec.LeaseTransitions) + 1)
+	return spec
 }
@@ -0,0 +1,207 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// LeaseDuration is the same as the controller-runtime default, since failover on shutdown doesn't wait for the
+	// lease to expire when the lease is released
+	LeaseDuration = 15 * time.Second
+	RenewDeadline = 10 * time.Second
+	// RetryPeriod is shorter than the controller-runtime default of 2s, so that candidates notice a released or
+	// handed off lease sooner
+	RetryPeriod = 500 * time.Millisecond
+)
+
+type Option struct {
+	// Identity of the candidate, defaults to <hostname>_<uuid>
+	Identity string
+	// CoordinationTimeout is how long a coordinated lock waits for the control plane to create the lease before
+	// creating it with lease election, defaults to 1 minute
+	CoordinationTimeout time.Duration
+}
+
+func WithIdentity(identity string) func(*Option) {
+	return func(o *Option) {
+		o.Identity = identity
+	}
+}
+
+func WithCoordinationTimeout(timeout time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.CoordinationTimeout = timeout
+	}
+}
+
+/*
+Lock is a Lease lock that yields leadership gracefully. When the manager is stopped, e.g. on SIGTERM, OnStoppedLeading
+hooks are run to drain in-flight work before the lease is released, and the lease is handed off to the successor, if
+one is set. The successor becomes leader on its next retry rather than waiting for the lease to expire.
+
+Include this in your controller manager as follows:
+```
+lock, err := leaderelection.NewLock(config, "namespace", name)
+options := controllerruntime.Options{...}
+lock.Apply(&options)
+controllerruntime.NewManager(config, options)
+```
+*/
+type Lock struct {
+	resourcelock.Interface
+
+	mu               sync.Mutex
+	leading          bool
+	successor        string
+	onStartedLeading []func()
+	onStoppedLeading []func()
+}
+
+func NewLock(config *rest.Config, namespace string, name string, opts ...option.Function[Option]) (*Lock, error) {
+	options := option.Resolve(opts...)
+	if options.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("getting hostname, %w", err)
+		}
+		options.Identity = fmt.Sprintf("%s_%s", hostname, uuid.NewUUID())
+	}
+	coreClient, err := corev1client.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating core client, %w", err)
+	}
+	coordinationClient, err := coordinationv1client.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating coordination client, %w", err)
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, name, coreClient, coordinationClient, resourcelock.ResourceLockConfig{Identity: options.Identity})
+	if err != nil {
+		return nil, fmt.Errorf("creating lease lock, %w", err)
+	}
+	return NewLockFor(lock), nil
+}
+
+// NewLockFor wraps an existing lock, e.g. one returned by LeaseHijacker
+func NewLockFor(lock resourcelock.Interface) *Lock {
+	return &Lock{Interface: lock}
+}
+
+// Apply configures the manager options to elect a leader with the lock, and to release it on shutdown
+func (l *Lock) Apply(options *manager.Options) {
+	options.LeaderElection = true
+	options.LeaderElectionResourceLockInterface = l
+	options.LeaderElectionReleaseOnCancel = true
+	options.LeaseDuration = lo.ToPtr(LeaseDuration)
+	options.RenewDeadline = lo.ToPtr(RenewDeadline)
+	options.RetryPeriod = lo.ToPtr(RetryPeriod)
+}
+
+// OnStartedLeading registers a hook that is called when the candidate acquires the lease. Hooks must not block.
+func (l *Lock) OnStartedLeading(hook func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onStartedLeading = append(l.onStartedLeading, hook)
+}
+
+// OnStoppedLeading registers a hook that is called before the lease is released. Hooks may block to drain in-flight
+// work, since other candidates can't become leader until they return.
+func (l *Lock) OnStoppedLeading(hook func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onStoppedLeading = append(l.onStoppedLeading, hook)
+}
+
+// HandOff sets the identity of the candidate that the lease is handed off to when it's released. An empty identity
+// releases the lease to any candidate.
+func (l *Lock) HandOff(identity string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successor = identity
+}
+
+// IsLeader returns true if the candidate holds the lease
+func (l *Lock) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leading
+}
+
+func (l *Lock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if err := l.Interface.Create(ctx, ler); err != nil {
+		return err
+	}
+	l.observe(ler)
+	return nil
+}
+
+func (l *Lock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	// The leader elector releases the lease by clearing the holder
+	if ler.HolderIdentity == "" {
+		return l.release(ctx, ler)
+	}
+	renewing := ler.HolderIdentity == l.Identity() && l.IsLeader()
+	start := time.Now()
+	if err := l.Interface.Update(ctx, ler); err != nil {
+		if renewing {
+			RenewFailuresTotal.Inc(map[string]string{MetricLabelLease: l.Describe()})
+		}
+		return err
+	}
+	if renewing {
+		RenewDuration.Observe(time.Since(start).Seconds(), map[string]string{MetricLabelLease: l.Describe()})
+	}
+	l.observe(ler)
+	return nil
+}
+
+func (l *Lock) observe(ler resourcelock.LeaderElectionRecord) {
+	l.mu.Lock()
+	started := ler.HolderIdentity == l.Identity() && !l.leading
+	l.leading = ler.HolderIdentity == l.Identity()
+	leading := l.leading
+	hooks := lo.Ternary(started, l.onStartedLeading, nil)
+	l.mu.Unlock()
+	IsLeader.Set(lo.Ternary[float64](leading, 1, 0), map[string]string{MetricLabelLease: l.Describe()})
+	if started {
+		TransitionsTotal.Inc(map[string]string{MetricLabelLease: l.Describe()})
+		AcquiredTimestampSeconds.Set(float64(time.Now().Unix()), map[string]string{MetricLabelLease: l.Describe()})
+	} else if !leading {
+		AcquiredTimestampSeconds.Set(0, map[string]string{MetricLabelLease: l.Describe()})
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+func (l *Lock) release(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	hooks := lo.Ternary(l.leading, l.onStoppedLeading, nil)
+	l.leading = false
+	successor := l.successor
+	l.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	IsLeader.Set(0, map[string]string{MetricLabelLease: l.Describe()})
+	AcquiredTimestampSeconds.Set(0, map[string]string{MetricLabelLease: l.Describe()})
+	// Candidates treat a lease held by their own identity as already acquired, so the successor renews it on its
+	// next retry, regardless of the short duration of the released lease
+	if successor != "" {
+		ler.HolderIdentity = successor
+		ler.LeaderTransitions++
+	}
+	return l.Interface.Update(ctx, ler)
+}
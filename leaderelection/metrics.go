@@ -0,0 +1,76 @@
+package leaderelection
+
+import (
+	pmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Leadership metrics are recorded by Lock as it observes the lease, so locks that aren't wrapped in a Lock, e.g. the
+// lock returned by LeaseHijacker or one created by controller-runtime from LeaderElectionID, don't record them. Wrap
+// them with NewLockFor to record metrics.
+const (
+	MetricSubsystem  = "leader_election"
+	MetricLabelLease = "lease"
+)
+
+// Cardinality is limited to # leases
+var IsLeader = pmetrics.NewPrometheusGauge(
+	metrics.Registry,
+	prometheus.GaugeOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "is_leader",
+		Help:      "Whether this replica holds the lease, 1 if it does and 0 otherwise.",
+	},
+	[]string{MetricLabelLease},
+)
+
+// Cardinality is limited to # leases
+var TransitionsTotal = pmetrics.NewPrometheusCounter(
+	metrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "transitions_total",
+		Help:      "The number of times this replica acquired the lease.",
+	},
+	[]string{MetricLabelLease},
+)
+
+// Cardinality is limited to # leases
+var AcquiredTimestampSeconds = pmetrics.NewPrometheusGauge(
+	metrics.Registry,
+	prometheus.GaugeOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "acquired_timestamp_seconds",
+		Help:      "The unix timestamp of when this replica acquired the lease, or 0 if it isn't the leader. e.g. Leadership duration := time() - acquired_timestamp_seconds",
+	},
+	[]string{MetricLabelLease},
+)
+
+// Cardinality is limited to # leases
+var RenewDuration = pmetrics.NewPrometheusHistogram(
+	metrics.Registry,
+	prometheus.HistogramOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "renew_duration_seconds",
+		Help:      "The amount of time taken by the leader to renew the lease. e.g. Alarm := P99(renew_duration_seconds) > renew deadline",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	},
+	[]string{MetricLabelLease},
+)
+
+// Cardinality is limited to # leases
+var RenewFailuresTotal = pmetrics.NewPrometheusCounter(
+	metrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "renew_failures_total",
+		Help:      "The number of times the leader failed to renew the lease.",
+	},
+	[]string{MetricLabelLease},
+)
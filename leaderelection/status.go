@@ -0,0 +1,85 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/awslabs/operatorpkg/object"
+	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/awslabs/operatorpkg/status"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	LeaderElectedReason  = "LeaderElected"
+	LeaderReleasedReason = "LeaderReleased"
+)
+
+// ReportTo surfaces leadership changes of the lock on an object, e.g. the operator's configuration object. An Event
+// is recorded if the recorder is set, and the condition is set to True while the candidate leads and to False once it
+// releases the lease, if the condition type is set. Reports are made in the order of the leadership changes.
+func ReportTo[T status.Object](lock *Lock, kubeClient client.Client, recorder record.EventRecorder, key client.ObjectKey, conditionType string) {
+	report := func(leading bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), RenewDeadline)
+		defer cancel()
+		if err := reportTo[T](ctx, lock.Identity(), leading, kubeClient, recorder, key, conditionType); err != nil {
+			serrors.NewLogger(log.Log).Error(err, "failed reporting leadership", "lease", lock.Describe())
+		}
+	}
+	// reported is closed once the last started report completes
+	mu := sync.Mutex{}
+	reported := make(chan struct{})
+	close(reported)
+	// Started hooks must not block the leader elector, so the report is made in the background
+	lock.OnStartedLeading(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		done := make(chan struct{})
+		reported = done
+		go func() {
+			defer close(done)
+			report(true)
+		}()
+	})
+	// Stopped hooks may block, so the stopped report waits for the started report rather than racing it, which could
+	// leave the condition True after the lease is released
+	lock.OnStoppedLeading(func() {
+		mu.Lock()
+		started := reported
+		mu.Unlock()
+		<-started
+		report(false)
+	})
+}
+
+func reportTo[T status.Object](ctx context.Context, identity string, leading bool, kubeClient client.Client, recorder record.EventRecorder, key client.ObjectKey, conditionType string) error {
+	obj := object.New[T]()
+	if err := kubeClient.Get(ctx, key, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if recorder != nil {
+		if leading {
+			recorder.Event(obj, v1.EventTypeNormal, LeaderElectedReason, fmt.Sprintf("%s acquired the lease", identity))
+		} else {
+			recorder.Event(obj, v1.EventTypeNormal, LeaderReleasedReason, fmt.Sprintf("%s released the lease", identity))
+		}
+	}
+	if conditionType == "" {
+		return nil
+	}
+	stored := obj.DeepCopyObject().(T)
+	modified := false
+	if leading {
+		modified = obj.StatusConditions().SetTrueWithReason(conditionType, LeaderElectedReason, fmt.Sprintf("%s is the leader", identity))
+	} else {
+		modified = obj.StatusConditions().SetFalse(conditionType, LeaderReleasedReason, fmt.Sprintf("%s released the lease", identity))
+	}
+	if !modified {
+		return nil
+	}
+	return client.IgnoreNotFound(kubeClient.Status().Patch(ctx, obj, client.MergeFrom(stored)))
+}
@@ -0,0 +1,473 @@
+package leaderelection_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awslabs/operatorpkg/leaderelection"
+	"github.com/awslabs/operatorpkg/test"
+	. "github.com/awslabs/operatorpkg/test/expectations"
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	clientleaderelection "k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var (
+	ctx        context.Context
+	kubeClient *fake.Clientset
+)
+
+var (
+	SchemeBuilder = runtime.NewSchemeBuilder(func(scheme *runtime.Scheme) error {
+		scheme.AddKnownTypes(schema.GroupVersion{Group: test.APIGroup, Version: "v1alpha1"}, &test.CustomObject{})
+		return nil
+	})
+)
+
+func Test(t *testing.T) {
+	lo.Must0(SchemeBuilder.AddToScheme(scheme.Scheme))
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LeaderElection")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = log.IntoContext(context.Background(), ginkgo.GinkgoLogr)
+})
+
+var _ = BeforeEach(func() {
+	kubeClient = fake.NewClientset()
+})
+
+func newLock(identity string) *leaderelection.Lock {
+	return leaderelection.NewLockFor(&resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Client:     kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	})
+}
+
+// run elects a leader with the same timings as Apply, returning a function that stops the candidate and waits for it
+// to release the lease
+func run(lock *leaderelection.Lock) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		defer close(done)
+		clientleaderelection.RunOrDie(ctx, clientleaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaderelection.LeaseDuration,
+			RenewDeadline:   leaderelection.RenewDeadline,
+			RetryPeriod:     leaderelection.RetryPeriod,
+			ReleaseOnCancel: true,
+			Callbacks: clientleaderelection.LeaderCallbacks{
+				OnStartedLeading: func(context.Context) {},
+				OnStoppedLeading: func() {},
+			},
+		})
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	DeferCleanup(stop)
+	return stop
+}
+
+func holder() string {
+	lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+	if err != nil || lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+var _ = Describe("Lock", func() {
+	It("should configure the manager to release the lease on shutdown", func() {
+		lock := newLock("a")
+		options := manager.Options{}
+		lock.Apply(&options)
+		Expect(options.LeaderElection).To(BeTrue())
+		Expect(options.LeaderElectionReleaseOnCancel).To(BeTrue())
+		Expect(options.LeaderElectionResourceLockInterface).To(Equal(lock))
+		Expect(*options.RetryPeriod).To(BeNumerically("<", 2*time.Second))
+	})
+	It("should call hooks when leadership starts and stops", func() {
+		lock := newLock("a")
+		started, stopped := atomic.Int32{}, atomic.Int32{}
+		lock.OnStartedLeading(func() { started.Add(1) })
+		lock.OnStoppedLeading(func() { stopped.Add(1) })
+
+		stop := run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+		// Renewals don't restart leadership
+		Consistently(started.Load, 2*leaderelection.RetryPeriod).Should(BeEquivalentTo(1))
+		Expect(stopped.Load()).To(BeEquivalentTo(0))
+
+		stop()
+		Expect(lock.IsLeader()).To(BeFalse())
+		Expect(stopped.Load()).To(BeEquivalentTo(1))
+		Expect(holder()).To(BeEmpty())
+	})
+	It("should drain before releasing the lease", func() {
+		lock := newLock("a")
+		var holderWhileDraining string
+		lock.OnStoppedLeading(func() { holderWhileDraining = holder() })
+
+		stop := run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+		stop()
+		Expect(holderWhileDraining).To(Equal("a"))
+	})
+	It("should hand off the lease to the successor without waiting for it to expire", func() {
+		leader, successor := newLock("a"), newLock("b")
+		stop := run(leader)
+		Eventually(leader.IsLeader).Should(BeTrue())
+		run(successor)
+		Consistently(successor.IsLeader, 2*leaderelection.RetryPeriod).Should(BeFalse())
+
+		leader.HandOff("b")
+		stop()
+		Expect(holder()).To(Equal("b"))
+		Eventually(successor.IsLeader, leaderelection.LeaseDuration/3).Should(BeTrue())
+	})
+	It("should release the lease to any candidate without a successor", func() {
+		leader, other := newLock("a"), newLock("b")
+		stop := run(leader)
+		Eventually(leader.IsLeader).Should(BeTrue())
+		run(other)
+
+		stop()
+		Eventually(other.IsLeader, leaderelection.LeaseDuration/3).Should(BeTrue())
+	})
+})
+
+var _ = Describe("LeaseHijacker", func() {
+	It("should fallback to controller-runtime lease settings if not enabled", func() {
+		lock, err := leaderelection.LeaseHijacker(ctx, nil, "default", "test")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lock).To(BeNil())
+	})
+	It("should create the lease if it doesn't exist", func() {
+		lock, err := leaderelection.HijackLease(ctx, kubeClient, "default", "test", "hijacker")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lock.Identity()).To(Equal("hijacker"))
+		lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*lease.Spec.HolderIdentity).To(Equal("hijacker"))
+		Expect(*lease.Spec.LeaseTransitions).To(BeEquivalentTo(1))
+	})
+	It("should take over an expired lease without waiting", func() {
+		_, err := kubeClient.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       lo.ToPtr("leader"),
+				LeaseDurationSeconds: lo.ToPtr[int32](15),
+				RenewTime:            lo.ToPtr(metav1.NewMicroTime(time.Now().Add(-time.Minute))),
+				LeaseTransitions:     lo.ToPtr[int32](3),
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = leaderelection.HijackLease(ctx, kubeClient, "default", "test", "hijacker")
+		Expect(err).ToNot(HaveOccurred())
+		lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*lease.Spec.HolderIdentity).To(Equal("hijacker"))
+		Expect(*lease.Spec.LeaseDurationSeconds).To(BeEquivalentTo(20))
+		Expect(*lease.Spec.LeaseTransitions).To(BeEquivalentTo(4))
+	})
+	It("should tolerate a lease without a renew time or duration", func() {
+		_, err := kubeClient.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = leaderelection.HijackLease(ctx, kubeClient, "default", "test", "hijacker")
+		Expect(err).ToNot(HaveOccurred())
+		lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*lease.Spec.HolderIdentity).To(Equal("hijacker"))
+		Expect(lease.Spec.LeaseDurationSeconds).ToNot(BeNil())
+	})
+	It("should retry conflicts", func() {
+		conflicts := 2
+		kubeClient.PrependReactor("update", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			if conflicts > 0 {
+				conflicts--
+				return true, nil, apierrors.NewConflict(coordinationv1.Resource("leases"), "test", fmt.Errorf("modified"))
+			}
+			return false, nil, nil
+		})
+		_, err := kubeClient.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = leaderelection.HijackLease(ctx, kubeClient, "default", "test", "hijacker")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conflicts).To(Equal(0))
+	})
+	It("should return an error instead of panicking", func() {
+		kubeClient.PrependReactor("get", "leases", func(clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(coordinationv1.Resource("leases"), "test", fmt.Errorf("denied"))
+		})
+		_, err := leaderelection.HijackLease(ctx, kubeClient, "default", "test", "hijacker")
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+	})
+	It("should stop waiting for the election when the context is cancelled", func() {
+		_, err := kubeClient.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       lo.ToPtr("leader"),
+				LeaseDurationSeconds: lo.ToPtr[int32](3600),
+				RenewTime:            lo.ToPtr(metav1.NowMicro()),
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err = leaderelection.HijackLease(ctx, kubeClient, "default", "test", "hijacker")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
+
+var _ = Describe("Coordinated", func() {
+	var candidateCtx context.Context
+	BeforeEach(func() {
+		var cancel context.CancelFunc
+		candidateCtx, cancel = context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		kubeClient.Resources = []*metav1.APIResourceList{{
+			GroupVersion: coordinationv1beta1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{{Name: "leasecandidates", Namespaced: true, Kind: "LeaseCandidate"}},
+		}}
+	})
+	newCoordinatedLock := func(identity string) *leaderelection.Lock {
+		lock, err := leaderelection.NewCoordinatedLock(candidateCtx, kubeClient, "default", "test", "1.2.0", "1.1.0", leaderelection.WithIdentity(identity))
+		Expect(err).ToNot(HaveOccurred())
+		return lock
+	}
+	assign := func(identity string, renewTime time.Time) {
+		_, err := kubeClient.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       lo.ToPtr(identity),
+				LeaseDurationSeconds: lo.ToPtr[int32](15),
+				RenewTime:            lo.ToPtr(metav1.NewMicroTime(renewTime)),
+				Strategy:             lo.ToPtr(coordinationv1.OldestEmulationVersion),
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("should fall back to lease election if lease candidates aren't supported", func() {
+		kubeClient.Resources = nil
+		lock := newCoordinatedLock("a")
+		run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+		Expect(holder()).To(Equal("a"))
+		candidates, err := kubeClient.CoordinationV1beta1().LeaseCandidates("default").List(ctx, metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(candidates.Items).To(BeEmpty())
+	})
+	It("should publish a lease candidate with its versions", func() {
+		newCoordinatedLock("a")
+		Eventually(func(g Gomega) {
+			candidate, err := kubeClient.CoordinationV1beta1().LeaseCandidates("default").Get(ctx, "a", metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(candidate.Spec.LeaseName).To(Equal("test"))
+			g.Expect(candidate.Spec.BinaryVersion).To(Equal("1.2.0"))
+			g.Expect(candidate.Spec.EmulationVersion).To(Equal("1.1.0"))
+			g.Expect(candidate.Spec.Strategy).To(Equal(coordinationv1.OldestEmulationVersion))
+		}).Should(Succeed())
+	})
+	It("should wait for the control plane to assign the lease", func() {
+		lock := newCoordinatedLock("a")
+		run(lock)
+		Consistently(lock.IsLeader, 2*leaderelection.RetryPeriod).Should(BeFalse())
+		Expect(holder()).To(BeEmpty())
+
+		assign("a", time.Now())
+		// Candidates retry with jitter, so they may take longer than the retry period to notice the assignment
+		Eventually(lock.IsLeader, 3*leaderelection.RetryPeriod).Should(BeTrue())
+		lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lease.Spec.Strategy).To(Equal(lo.ToPtr(coordinationv1.OldestEmulationVersion)))
+	})
+	It("should fall back to lease election if the control plane doesn't assign the lease", func() {
+		lock, err := leaderelection.NewCoordinatedLock(candidateCtx, kubeClient, "default", "test", "1.2.0", "1.1.0",
+			leaderelection.WithIdentity("a"), leaderelection.WithCoordinationTimeout(2*leaderelection.RetryPeriod))
+		Expect(err).ToNot(HaveOccurred())
+		run(lock)
+		Consistently(lock.IsLeader, leaderelection.RetryPeriod).Should(BeFalse())
+		Eventually(lock.IsLeader, 3*time.Second).Should(BeTrue())
+		Expect(holder()).To(Equal("a"))
+		lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lease.Spec.Strategy).To(BeNil())
+	})
+	It("should return an error if the lease candidate cache doesn't sync", func() {
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := leaderelection.NewCoordinatedLock(cancelledCtx, kubeClient, "default", "test", "1.2.0", "1.1.0", leaderelection.WithIdentity("a"))
+		Expect(err).To(HaveOccurred())
+	})
+	It("should not acquire an expired lease that is assigned to another candidate", func() {
+		assign("b", time.Now().Add(-time.Minute))
+		lock := newCoordinatedLock("a")
+		run(lock)
+		Consistently(lock.IsLeader, 2*leaderelection.RetryPeriod).Should(BeFalse())
+		Expect(holder()).To(Equal("b"))
+	})
+	It("should stop renewing the lease when the control plane prefers another candidate", func() {
+		assign("a", time.Now())
+		lock := newCoordinatedLock("a")
+		run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+
+		lease, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		lease.Spec.PreferredHolder = lo.ToPtr("b")
+		lease, err = kubeClient.CoordinationV1().Leases("default").Update(ctx, lease, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Consistently(func(g Gomega) {
+			current, err := kubeClient.CoordinationV1().Leases("default").Get(ctx, "test", metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(current.Spec.RenewTime).To(Equal(lease.Spec.RenewTime))
+		}, 4*leaderelection.RetryPeriod).Should(Succeed())
+	})
+	It("should acquire leases that aren't managed by the control plane", func() {
+		_, err := kubeClient.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       lo.ToPtr("previous"),
+				LeaseDurationSeconds: lo.ToPtr[int32](1),
+				RenewTime:            lo.ToPtr(metav1.NewMicroTime(time.Now().Add(-time.Minute))),
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		lock := newCoordinatedLock("a")
+		run(lock)
+		// Candidates wait for the lease duration after they first observe the lease
+		Eventually(lock.IsLeader, 3*time.Second).Should(BeTrue())
+	})
+})
+
+var _ = Describe("Metrics", func() {
+	labels := map[string]string{leaderelection.MetricLabelLease: "default/test"}
+	counter := func(name string) float64 {
+		if metric := GetMetric(name, labels); metric != nil {
+			return metric.GetCounter().GetValue()
+		}
+		return 0
+	}
+
+	It("should report leadership", func() {
+		transitions := counter("operator_leader_election_transitions_total")
+		lock := newLock("a")
+		stop := run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+		Expect(GetMetric("operator_leader_election_is_leader", labels).GetGauge().GetValue()).To(BeEquivalentTo(1))
+		Expect(GetMetric("operator_leader_election_acquired_timestamp_seconds", labels).GetGauge().GetValue()).To(BeNumerically(">", 0))
+		Expect(counter("operator_leader_election_transitions_total")).To(Equal(transitions + 1))
+		Eventually(func() uint64 {
+			return GetMetric("operator_leader_election_renew_duration_seconds", labels).GetHistogram().GetSampleCount()
+		}).Should(BeNumerically(">", 0))
+
+		stop()
+		Expect(GetMetric("operator_leader_election_is_leader", labels).GetGauge().GetValue()).To(BeEquivalentTo(0))
+		Expect(GetMetric("operator_leader_election_acquired_timestamp_seconds", labels).GetGauge().GetValue()).To(BeEquivalentTo(0))
+	})
+	It("should report renew failures", func() {
+		failures := counter("operator_leader_election_renew_failures_total")
+		// Reactors can't be added while the fake clientset is in use
+		unavailable := atomic.Bool{}
+		kubeClient.PrependReactor("update", "leases", func(clienttesting.Action) (bool, runtime.Object, error) {
+			if unavailable.Load() {
+				return true, nil, fmt.Errorf("unavailable")
+			}
+			return false, nil, nil
+		})
+		lock := newLock("a")
+		run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+
+		unavailable.Store(true)
+		Eventually(func() float64 { return counter("operator_leader_election_renew_failures_total") }).Should(BeNumerically(">", failures))
+	})
+})
+
+var _ = Describe("ReportTo", func() {
+	It("should surface leadership changes on the object", func() {
+		ctrlClient := ctrlfake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(&test.CustomObject{}).Build()
+		obj := test.Object(&test.CustomObject{})
+		ExpectApplied(ctx, ctrlClient, obj)
+		recorder := record.NewFakeRecorder(10)
+		lock := newLock("a")
+		leaderelection.ReportTo[*test.CustomObject](lock, ctrlClient, recorder, client.ObjectKeyFromObject(obj), test.ConditionTypeFoo)
+
+		stop := run(lock)
+		Eventually(recorder.Events).Should(Receive(Equal("Normal LeaderElected a acquired the lease")))
+		Eventually(func(g Gomega) {
+			g.Expect(ctrlClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+			condition := obj.StatusConditions().Get(test.ConditionTypeFoo)
+			g.Expect(condition.IsTrue()).To(BeTrue())
+			g.Expect(condition.Reason).To(Equal(leaderelection.LeaderElectedReason))
+		}).Should(Succeed())
+
+		stop()
+		Expect(recorder.Events).To(Receive(Equal("Normal LeaderReleased a released the lease")))
+		ExpectObject(ctx, ctrlClient, obj)
+		condition := obj.StatusConditions().Get(test.ConditionTypeFoo)
+		Expect(condition.IsFalse()).To(BeTrue())
+		Expect(condition.Reason).To(Equal(leaderelection.LeaderReleasedReason))
+	})
+	It("should report leadership changes in order when the started report is slow", func() {
+		gets := atomic.Int32{}
+		ctrlClient := ctrlfake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(&test.CustomObject{}).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				// Delay the started report until after the lease is released
+				if gets.Add(1) == 1 {
+					time.Sleep(time.Second)
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+		obj := test.Object(&test.CustomObject{})
+		Expect(ctrlClient.Create(ctx, obj)).To(Succeed())
+		recorder := record.NewFakeRecorder(10)
+		lock := newLock("a")
+		leaderelection.ReportTo[*test.CustomObject](lock, ctrlClient, recorder, client.ObjectKeyFromObject(obj), test.ConditionTypeFoo)
+
+		stop := run(lock)
+		Eventually(lock.IsLeader).Should(BeTrue())
+		stop()
+		Expect(recorder.Events).To(Receive(Equal("Normal LeaderElected a acquired the lease")))
+		Expect(recorder.Events).To(Receive(Equal("Normal LeaderReleased a released the lease")))
+		Expect(ctrlClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		Expect(obj.StatusConditions().Get(test.ConditionTypeFoo).IsFalse()).To(BeTrue())
+	})
+})
@@ -2,9 +2,13 @@ package mock
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"log"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // atomicPtr is intended for use in mocks to easily expose variables for use in testing.  It makes setting and retrieving
@@ -142,3 +146,172 @@ func (a *atomicPtrSlice[T]) ForEach(fn func(*T)) {
 		fn(clone(t))
 	}
 }
+
+// Response is a scripted response of a Function, which returns the error if it's set and the output otherwise
+type Response[O any] struct {
+	Output *O
+	Error  error
+}
+
+type stub[I any, O any] struct {
+	matches  func(*I) bool
+	response Response[O]
+}
+
+// atomicResponses exposes scripted responses in a race-free manner. Queued responses are returned once each, in
+// order, and stubs are returned every time their matcher matches the input.
+type atomicResponses[I any, O any] struct {
+	mu    sync.Mutex
+	queue []Response[O]
+	stubs []stub[I, O]
+}
+
+// Enqueue adds responses that are returned by the next calls, in order, e.g. Enqueue(Response[O]{Output: a},
+// Response[O]{Output: b}, Response[O]{Error: err}) returns a, then b, then the error
+func (a *atomicResponses[I, O]) Enqueue(responses ...Response[O]) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queue = append(a.queue, responses...)
+}
+
+// When returns the response whenever the input matches. Stubs take precedence over queued responses, and the first
+// stub that matches wins.
+func (a *atomicResponses[I, O]) When(matches func(*I) bool, response Response[O]) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stubs = append(a.stubs, stub[I, O]{matches: matches, response: response})
+}
+
+// Len returns the number of queued responses that haven't been returned
+func (a *atomicResponses[I, O]) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.queue)
+}
+
+func (a *atomicResponses[I, O]) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queue = nil
+	a.stubs = nil
+}
+
+// next returns the response for the input, if there is one. The output is deep copied like atomicPtr.Clone, and the
+// matchers are passed a copy of the input, so neither races with the caller.
+func (a *atomicResponses[I, O]) next(input *I) (Response[O], bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, s := range a.stubs {
+		if s.matches(clone(input)) {
+			return s.response.clone(), true
+		}
+	}
+	if len(a.queue) == 0 {
+		return Response[O]{}, false
+	}
+	response := a.queue[0]
+	a.queue = a.queue[1:]
+	return response.clone(), true
+}
+
+func (r Response[O]) clone() Response[O] {
+	if r.Output == nil {
+		return r
+	}
+	return Response[O]{Output: clone(r.Output), Error: r.Error}
+}
+
+// atomicDelay exposes the delay of each call in a race-free manner
+type atomicDelay struct {
+	mu    sync.Mutex
+	delay func() time.Duration
+}
+
+// Set delays every call by d
+func (a *atomicDelay) Set(d time.Duration) {
+	a.SetFunc(func() time.Duration { return d })
+}
+
+// SetRandom delays every call by a duration drawn uniformly between minDelay and maxDelay
+func (a *atomicDelay) SetRandom(minDelay, maxDelay time.Duration) {
+	a.SetFunc(func() time.Duration {
+		if maxDelay <= minDelay {
+			return minDelay
+		}
+		return minDelay + rand.N(maxDelay-minDelay)
+	})
+}
+
+// SetFunc delays every call by the duration returned by fn, e.g. to draw delays from another distribution
+func (a *atomicDelay) SetFunc(fn func() time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.delay = fn
+}
+
+func (a *atomicDelay) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.delay = nil
+}
+
+func (a *atomicDelay) get() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.delay == nil {
+		return 0
+	}
+	return a.delay()
+}
+
+// atomicGate blocks calls until it's released, e.g. to hold calls in flight while testing concurrency limits
+type atomicGate struct {
+	mu      sync.Mutex
+	blocked chan struct{}
+	waiting atomic.Int32
+}
+
+// Block makes calls block until Release is called
+func (g *atomicGate) Block() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.blocked == nil {
+		g.blocked = make(chan struct{})
+	}
+}
+
+// Release unblocks the blocked calls, and stops blocking calls until Block is called again
+func (g *atomicGate) Release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.blocked != nil {
+		close(g.blocked)
+		g.blocked = nil
+	}
+}
+
+// Waiting returns the number of calls that are blocked
+func (g *atomicGate) Waiting() int {
+	return int(g.waiting.Load())
+}
+
+func (g *atomicGate) Reset() {
+	g.Release()
+}
+
+func (g *atomicGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	blocked := g.blocked
+	g.mu.Unlock()
+	if blocked == nil {
+		return nil
+	}
+	g.waiting.Add(1)
+	defer g.waiting.Add(-1)
+	select {
+	case <-blocked:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,13 +1,18 @@
 package mock
 
 import (
+	"context"
 	"sync/atomic"
+	"time"
 )
 
 type Function[I any, O any] struct {
-	Output          atomicPtr[O]      // Output to return on call to this function
-	CalledWithInput atomicPtrSlice[I] // Slice used to keep track of passed input to this function
-	Error           atomicError       // Error to return a certain number of times defined by custom error options
+	Output          atomicPtr[O]          // Output to return on call to this function
+	CalledWithInput atomicPtrSlice[I]     // Slice used to keep track of passed input to this function
+	Error           atomicError           // Error to return a certain number of times defined by custom error options
+	Responses       atomicResponses[I, O] // Scripted responses, returned before Output and the default transformer
+	Delay           atomicDelay           // Delay of each call, fixed or drawn from a distribution
+	Gate            atomicGate            // Gate that blocks calls until it's released
 
 	successfulCalls atomic.Int32 // Internal construct to keep track of the number of times this function has successfully been called
 	failedCalls     atomic.Int32 // Internal construct to keep track of the number of times this function has failed (with error)
@@ -19,12 +24,25 @@ func (m *Function[I, O]) Reset() {
 	m.Output.Reset()
 	m.CalledWithInput.Reset()
 	m.Error.Reset()
+	m.Responses.Reset()
+	m.Delay.Reset()
+	m.Gate.Reset()
 
 	m.successfulCalls.Store(0)
 	m.failedCalls.Store(0)
 }
 
 func (m *Function[I, O]) Invoke(input *I, defaultTransformer func(*I) (*O, error)) (*O, error) {
+	return m.InvokeContext(context.Background(), input, defaultTransformer)
+}
+
+// InvokeContext waits for the gate and the delay before responding, and fails with the context's error if the context
+// is canceled first
+func (m *Function[I, O]) InvokeContext(ctx context.Context, input *I, defaultTransformer func(*I) (*O, error)) (*O, error) {
+	if err := m.wait(ctx); err != nil {
+		m.failedCalls.Add(1)
+		return nil, err
+	}
 	err := m.Error.Get()
 	if err != nil {
 		m.failedCalls.Add(1)
@@ -32,6 +50,14 @@ func (m *Function[I, O]) Invoke(input *I, defaultTransformer func(*I) (*O, error
 	}
 	m.CalledWithInput.Add(input)
 
+	if response, ok := m.Responses.next(input); ok {
+		if response.Error != nil {
+			m.failedCalls.Add(1)
+			return nil, response.Error
+		}
+		m.successfulCalls.Add(1)
+		return response.Output, nil
+	}
 	if !m.Output.IsNil() {
 		m.successfulCalls.Add(1)
 		return m.Output.Clone(), nil
@@ -45,6 +71,21 @@ func (m *Function[I, O]) Invoke(input *I, defaultTransformer func(*I) (*O, error
 	return out, err
 }
 
+func (m *Function[I, O]) wait(ctx context.Context) error {
+	if err := m.Gate.wait(ctx); err != nil {
+		return err
+	}
+	if delay := m.Delay.get(); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
 func (m *Function[I, O]) Calls() int {
 	return m.SuccessfulCalls() + m.FailedCalls()
 }
@@ -0,0 +1,186 @@
+package mock_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/awslabs/operatorpkg/mock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mock")
+}
+
+type Input struct {
+	Name string
+}
+
+type Output struct {
+	Value string
+}
+
+var fn mock.Function[Input, Output]
+
+// echo is the default transformer, which returns the name of the input
+func echo(input *Input) (*Output, error) {
+	return &Output{Value: input.Name}, nil
+}
+
+var _ = BeforeEach(func() {
+	fn.Reset()
+})
+
+var _ = Describe("Responses", func() {
+	It("should return queued responses in order", func() {
+		fn.Responses.Enqueue(
+			mock.Response[Output]{Output: &Output{Value: "a"}},
+			mock.Response[Output]{Output: &Output{Value: "b"}},
+			mock.Response[Output]{Error: errors.New("failed")},
+		)
+		Expect(fn.Invoke(&Input{}, echo)).To(Equal(&Output{Value: "a"}))
+		Expect(fn.Invoke(&Input{}, echo)).To(Equal(&Output{Value: "b"}))
+		_, err := fn.Invoke(&Input{}, echo)
+		Expect(err).To(MatchError("failed"))
+		Expect(fn.Responses.Len()).To(Equal(0))
+		Expect(fn.SuccessfulCalls()).To(Equal(2))
+		Expect(fn.FailedCalls()).To(Equal(1))
+		Expect(fn.CalledWithInput.Len()).To(Equal(3))
+	})
+	It("should fall back to the output and then the default transformer", func() {
+		fn.Responses.Enqueue(mock.Response[Output]{Output: &Output{Value: "queued"}})
+		Expect(fn.Invoke(&Input{Name: "test"}, echo)).To(Equal(&Output{Value: "queued"}))
+		Expect(fn.Invoke(&Input{Name: "test"}, echo)).To(Equal(&Output{Value: "test"}))
+		fn.Output.Set(&Output{Value: "output"})
+		Expect(fn.Invoke(&Input{Name: "test"}, echo)).To(Equal(&Output{Value: "output"}))
+	})
+	It("should return stubs when the input matches", func() {
+		fn.Responses.When(func(input *Input) bool { return input.Name == "missing" }, mock.Response[Output]{Error: errors.New("not found")})
+		fn.Responses.When(func(input *Input) bool { return input.Name == "x" }, mock.Response[Output]{Output: &Output{Value: "y"}})
+		fn.Responses.Enqueue(mock.Response[Output]{Output: &Output{Value: "queued"}})
+
+		Expect(fn.Invoke(&Input{Name: "x"}, echo)).To(Equal(&Output{Value: "y"}))
+		Expect(fn.Invoke(&Input{Name: "x"}, echo)).To(Equal(&Output{Value: "y"}))
+		_, err := fn.Invoke(&Input{Name: "missing"}, echo)
+		Expect(err).To(MatchError("not found"))
+		Expect(fn.Invoke(&Input{Name: "other"}, echo)).To(Equal(&Output{Value: "queued"}))
+		Expect(fn.Invoke(&Input{Name: "other"}, echo)).To(Equal(&Output{Value: "other"}))
+	})
+	It("should prefer the error to scripted responses", func() {
+		fn.Error.Set(errors.New("failed"))
+		fn.Responses.Enqueue(mock.Response[Output]{Output: &Output{Value: "queued"}})
+		_, err := fn.Invoke(&Input{}, echo)
+		Expect(err).To(MatchError("failed"))
+		Expect(fn.Invoke(&Input{}, echo)).To(Equal(&Output{Value: "queued"}))
+	})
+	It("should copy outputs so callers can't modify them", func() {
+		output := &Output{Value: "a"}
+		fn.Responses.When(func(*Input) bool { return true }, mock.Response[Output]{Output: output})
+		out, err := fn.Invoke(&Input{}, echo)
+		Expect(err).ToNot(HaveOccurred())
+		out.Value = "modified"
+		Expect(fn.Invoke(&Input{}, echo)).To(Equal(&Output{Value: "a"}))
+	})
+	It("should return each queued response once when called concurrently", func() {
+		for i := range 100 {
+			fn.Responses.Enqueue(mock.Response[Output]{Output: &Output{Value: fmt.Sprint(i)}})
+		}
+		values := sync.Map{}
+		wg := sync.WaitGroup{}
+		for range 100 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				out, err := fn.Invoke(&Input{}, echo)
+				Expect(err).ToNot(HaveOccurred())
+				_, loaded := values.LoadOrStore(out.Value, true)
+				Expect(loaded).To(BeFalse())
+			}()
+		}
+		wg.Wait()
+		Expect(fn.Responses.Len()).To(Equal(0))
+		Expect(fn.SuccessfulCalls()).To(Equal(100))
+	})
+})
+
+var _ = Describe("Delays", func() {
+	It("should delay calls", func() {
+		fn.Delay.Set(50 * time.Millisecond)
+		start := time.Now()
+		Expect(fn.Invoke(&Input{Name: "test"}, echo)).To(Equal(&Output{Value: "test"}))
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+	It("should delay calls by random durations within the range", func() {
+		fn.Delay.SetRandom(10*time.Millisecond, 30*time.Millisecond)
+		for range 3 {
+			start := time.Now()
+			_, err := fn.Invoke(&Input{}, echo)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", 10*time.Millisecond))
+		}
+	})
+	It("should return the context's error when the context is canceled while delayed", func() {
+		fn.Delay.Set(time.Hour)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := fn.InvokeContext(ctx, &Input{}, echo)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(fn.FailedCalls()).To(Equal(1))
+		Expect(fn.CalledWithInput.Len()).To(Equal(0))
+	})
+	It("should return the context's error when the context is already canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := fn.InvokeContext(ctx, &Input{}, echo)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
+
+var _ = Describe("Gate", func() {
+	It("should block calls until released", func() {
+		fn.Gate.Block()
+		done := make(chan struct{})
+		for range 3 {
+			go func() {
+				defer GinkgoRecover()
+				_, err := fn.Invoke(&Input{}, echo)
+				Expect(err).ToNot(HaveOccurred())
+				done <- struct{}{}
+			}()
+		}
+		Eventually(fn.Gate.Waiting).Should(Equal(3))
+		Consistently(done).ShouldNot(Receive())
+		Expect(fn.Calls()).To(Equal(0))
+
+		fn.Gate.Release()
+		for range 3 {
+			Eventually(done).Should(Receive())
+		}
+		Expect(fn.Gate.Waiting()).To(Equal(0))
+		Expect(fn.SuccessfulCalls()).To(Equal(3))
+	})
+	It("should return the context's error when the context is canceled while blocked", func() {
+		fn.Gate.Block()
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+		go func() { _, err := fn.InvokeContext(ctx, &Input{}, echo); errs <- err }()
+		Eventually(fn.Gate.Waiting).Should(Equal(1))
+		cancel()
+		Eventually(errs).Should(Receive(MatchError(context.Canceled)))
+	})
+	It("should release blocked calls on reset", func() {
+		fn.Gate.Block()
+		errs := make(chan error)
+		go func() { _, err := fn.Invoke(&Input{}, echo); errs <- err }()
+		Eventually(fn.Gate.Waiting).Should(Equal(1))
+		fn.Reset()
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+})
@@ -0,0 +1,191 @@
+package reasonable
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"golang.org/x/time/rate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// JitteredRateLimiter is an exponential failure rate limiter with full jitter. Each delay is drawn uniformly between
+// zero and the exponential cap, min(max delay, base delay * 2^failures), so requests that fail together don't retry
+// together, including on their first failure.
+type JitteredRateLimiter struct {
+	mu        sync.Mutex
+	failures  map[reconcile.Request]int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+func NewJitteredRateLimiter(opts ...option.Function[Option]) *JitteredRateLimiter {
+	o := resolve(opts...)
+	return &JitteredRateLimiter{
+		failures:  map[reconcile.Request]int{},
+		baseDelay: o.BaseDelay,
+		maxDelay:  o.MaxDelay,
+	}
+}
+
+func (r *JitteredRateLimiter) When(item reconcile.Request) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	exp := r.failures[item]
+	r.failures[item]++
+
+	// Compare against the max before multiplying to avoid overflowing on large exponents
+	ceiling := r.maxDelay
+	if exp < 62 && float64(r.baseDelay)*float64(uint64(1)<<exp) < float64(r.maxDelay) {
+		ceiling = r.baseDelay * time.Duration(uint64(1)<<exp)
+	}
+	return rand.N(ceiling + 1)
+}
+
+func (r *JitteredRateLimiter) NumRequeues(item reconcile.Request) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failures[item]
+}
+
+func (r *JitteredRateLimiter) Forget(item reconcile.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, item)
+}
+
+// NamespaceFairRateLimiter keeps a separate token bucket for every namespace, so that a single noisy namespace
+// cannot exhaust the tokens of the others. Cluster scoped objects share the bucket of the empty namespace. Buckets
+// are evicted once they refill, so namespaces that churn don't grow the rate limiter without bound.
+//
+// It only limits the overall rate of each namespace and doesn't back off items that fail repeatedly, so it should be
+// combined with a backoff rate limiter, e.g.
+//
+//	workqueue.NewTypedMaxOfRateLimiter(reasonable.NewJitteredRateLimiter(), reasonable.NewNamespaceFairRateLimiter())
+type NamespaceFairRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+	qps     float64
+	burst   int
+	// lastEviction is when idle buckets were last evicted
+	lastEviction time.Time
+}
+
+func NewNamespaceFairRateLimiter(opts ...option.Function[Option]) *NamespaceFairRateLimiter {
+	o := resolve(opts...)
+	return &NamespaceFairRateLimiter{
+		buckets: map[string]*rate.Limiter{},
+		qps:     o.QPS,
+		burst:   o.Burst,
+	}
+}
+
+func (r *NamespaceFairRateLimiter) When(item reconcile.Request) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.evict(now)
+	bucket, ok := r.buckets[item.Namespace]
+	if !ok {
+		bucket = rate.NewLimiter(rate.Limit(r.qps), r.burst)
+		r.buckets[item.Namespace] = bucket
+	}
+	return bucket.ReserveN(now, 1).DelayFrom(now)
+}
+
+// evict removes the buckets that have refilled, which behave the same as new buckets. A bucket refills within
+// burst / qps of its last reservation, so buckets are checked at most once in that period.
+func (r *NamespaceFairRateLimiter) evict(now time.Time) {
+	if now.Sub(r.lastEviction) < time.Duration(float64(r.burst)/r.qps*float64(time.Second)) {
+		return
+	}
+	r.lastEviction = now
+	for namespace, bucket := range r.buckets {
+		if bucket.TokensAt(now) >= float64(r.burst) {
+			delete(r.buckets, namespace)
+		}
+	}
+}
+
+// Len returns the number of namespaces that have a bucket
+func (r *NamespaceFairRateLimiter) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.buckets)
+}
+
+func (r *NamespaceFairRateLimiter) NumRequeues(_ reconcile.Request) int {
+	return 0
+}
+
+func (r *NamespaceFairRateLimiter) Forget(_ reconcile.Request) {}
+
+// RetryAfterRateLimiter wraps a rate limiter and honors the retry-after hints of errors observed for an item.
+// Hints are consumed by the next call to When and are capped at the max delay. Each observation replaces the item's
+// hint, so a reconcile that succeeds or returns an error without a hint drops the hint of an earlier error rather
+// than delaying a later requeue with it.
+type RetryAfterRateLimiter struct {
+	workqueue.TypedRateLimiter[reconcile.Request]
+
+	mu       sync.Mutex
+	hints    map[reconcile.Request]time.Duration
+	maxDelay time.Duration
+}
+
+// NewRetryAfterRateLimiter wraps the rate limiter. reconciler.AsReconcilerWithRateLimiter observes the result of every
+// reconcile, and controller-runtime requeues returned errors with the controller's rate limiter, so hints only delay
+// error requeues when the same rate limiter is also the controller's. Otherwise they're dropped by the next reconcile.
+func NewRetryAfterRateLimiter(rateLimiter workqueue.TypedRateLimiter[reconcile.Request], opts ...option.Function[Option]) *RetryAfterRateLimiter {
+	return &RetryAfterRateLimiter{
+		TypedRateLimiter: rateLimiter,
+		hints:            map[reconcile.Request]time.Duration{},
+		maxDelay:         resolve(opts...).MaxDelay,
+	}
+}
+
+// ObserveError records the retry-after hint of the error, or drops the item's hint if the error is nil or has none
+func (r *RetryAfterRateLimiter) ObserveError(item reconcile.Request, err error) {
+	hint, ok := RetryAfter(err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !ok {
+		delete(r.hints, item)
+		return
+	}
+	r.hints[item] = min(hint, r.maxDelay)
+}
+
+func (r *RetryAfterRateLimiter) When(item reconcile.Request) time.Duration {
+	delay := r.TypedRateLimiter.When(item)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if hint, ok := r.hints[item]; ok {
+		delete(r.hints, item)
+		return max(delay, hint)
+	}
+	return delay
+}
+
+func (r *RetryAfterRateLimiter) Forget(item reconcile.Request) {
+	r.mu.Lock()
+	delete(r.hints, item)
+	r.mu.Unlock()
+	r.TypedRateLimiter.Forget(item)
+}
+
+// RetryAfter returns the delay that an error suggests before retrying. Errors can provide a hint by implementing
+// RetryAfter() time.Duration, and Kubernetes API errors provide one through their status details.
+func RetryAfter(err error) (time.Duration, bool) {
+	var hinter interface{ RetryAfter() time.Duration }
+	if errors.As(err, &hinter) && hinter.RetryAfter() > 0 {
+		return hinter.RetryAfter(), true
+	}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
@@ -4,14 +4,65 @@ package reasonable
 import (
 	"time"
 
+	"github.com/awslabs/operatorpkg/option"
 	"golang.org/x/time/rate"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-func RateLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
+// Option configures the rate limiters in this package. Unset fields fall back to the reasonable defaults.
+type Option struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	QPS       float64
+	Burst     int
+}
+
+func WithBaseDelay(d time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.BaseDelay = d
+	}
+}
+
+func WithMaxDelay(d time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.MaxDelay = d
+	}
+}
+
+func WithQPS(qps float64) func(*Option) {
+	return func(o *Option) {
+		o.QPS = qps
+	}
+}
+
+func WithBurst(burst int) func(*Option) {
+	return func(o *Option) {
+		o.Burst = burst
+	}
+}
+
+func resolve(opts ...option.Function[Option]) *Option {
+	o := option.Resolve(opts...)
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = 100 * time.Millisecond
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 1 * time.Minute
+	}
+	if o.QPS <= 0 {
+		o.QPS = 10
+	}
+	if o.Burst <= 0 {
+		o.Burst = 100
+	}
+	return o
+}
+
+func RateLimiter(opts ...option.Function[Option]) workqueue.TypedRateLimiter[reconcile.Request] {
+	o := resolve(opts...)
 	return workqueue.NewTypedMaxOfRateLimiter[reconcile.Request](
-		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](100*time.Millisecond, 1*time.Minute),
-		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](o.BaseDelay, o.MaxDelay),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(o.QPS), o.Burst)},
 	)
 }
@@ -0,0 +1,146 @@
+package reasonable_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/awslabs/operatorpkg/reasonable"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reasonable")
+}
+
+type retryAfterError struct {
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return "throttled"
+}
+
+func (e *retryAfterError) RetryAfter() time.Duration {
+	return e.delay
+}
+
+func request(namespace, name string) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+var _ = Describe("Reasonable", func() {
+	Context("JitteredRateLimiter", func() {
+		It("should return delays between zero and the exponential cap", func() {
+			rateLimiter := reasonable.NewJitteredRateLimiter(reasonable.WithBaseDelay(10*time.Millisecond), reasonable.WithMaxDelay(time.Second))
+			req := request("default", "test")
+			for i := range 20 {
+				ceiling := min(10*time.Millisecond*time.Duration(1<<i), time.Second)
+				Expect(rateLimiter.When(req)).To(And(BeNumerically(">=", 0), BeNumerically("<=", ceiling)))
+			}
+			Expect(rateLimiter.NumRequeues(req)).To(Equal(20))
+		})
+		It("should spread the delays of items that fail together", func() {
+			rateLimiter := reasonable.NewJitteredRateLimiter()
+			delays := map[time.Duration]struct{}{}
+			for i := range 100 {
+				delays[rateLimiter.When(request("default", fmt.Sprint(i)))] = struct{}{}
+			}
+			Expect(len(delays)).To(BeNumerically(">", 50))
+		})
+		It("should not overflow after many failures", func() {
+			rateLimiter := reasonable.NewJitteredRateLimiter()
+			req := request("default", "test")
+			for range 100 {
+				Expect(rateLimiter.When(req)).To(And(BeNumerically(">=", 0), BeNumerically("<=", time.Minute)))
+			}
+		})
+		It("should reset the backoff when an item is forgotten", func() {
+			rateLimiter := reasonable.NewJitteredRateLimiter()
+			req := request("default", "test")
+			rateLimiter.When(req)
+			rateLimiter.When(req)
+			rateLimiter.Forget(req)
+			Expect(rateLimiter.NumRequeues(req)).To(Equal(0))
+			Expect(rateLimiter.When(req)).To(BeNumerically("<=", 100*time.Millisecond))
+		})
+	})
+	Context("NamespaceFairRateLimiter", func() {
+		It("should not let one namespace starve another", func() {
+			rateLimiter := reasonable.NewNamespaceFairRateLimiter(reasonable.WithQPS(1), reasonable.WithBurst(5))
+			for i := range 5 {
+				Expect(rateLimiter.When(request("noisy", fmt.Sprint(i)))).To(BeZero())
+			}
+			Expect(rateLimiter.When(request("noisy", "overflow"))).To(BeNumerically(">", 0))
+			Expect(rateLimiter.When(request("quiet", "test"))).To(BeZero())
+		})
+		It("should evict the buckets of namespaces once they refill", func() {
+			rateLimiter := reasonable.NewNamespaceFairRateLimiter(reasonable.WithQPS(1000), reasonable.WithBurst(1))
+			for i := range 10 {
+				rateLimiter.When(request(fmt.Sprint(i), "test"))
+			}
+			time.Sleep(10 * time.Millisecond)
+			Expect(rateLimiter.When(request("default", "test"))).To(BeZero())
+			Expect(rateLimiter.Len()).To(Equal(1))
+		})
+		It("should keep the buckets of namespaces that are still limited", func() {
+			rateLimiter := reasonable.NewNamespaceFairRateLimiter(reasonable.WithQPS(10), reasonable.WithBurst(1))
+			for range 3 {
+				rateLimiter.When(request("noisy", "test"))
+			}
+			// The buckets are checked after 100ms, but the noisy bucket doesn't refill for 300ms
+			time.Sleep(150 * time.Millisecond)
+			rateLimiter.When(request("quiet", "test"))
+			Expect(rateLimiter.Len()).To(Equal(2))
+			Expect(rateLimiter.When(request("noisy", "test"))).To(BeNumerically(">", 0))
+		})
+	})
+	Context("RetryAfterRateLimiter", func() {
+		It("should honor the retry-after hint of an observed error once", func() {
+			rateLimiter := reasonable.NewRetryAfterRateLimiter(workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Millisecond, time.Second))
+			req := request("default", "test")
+			rateLimiter.ObserveError(req, &retryAfterError{delay: 5 * time.Second})
+			Expect(rateLimiter.When(req)).To(Equal(5 * time.Second))
+			Expect(rateLimiter.When(req)).To(Equal(2 * time.Millisecond))
+		})
+		It("should cap the retry-after hint to the max delay", func() {
+			rateLimiter := reasonable.NewRetryAfterRateLimiter(workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Millisecond, time.Second), reasonable.WithMaxDelay(2*time.Second))
+			req := request("default", "test")
+			rateLimiter.ObserveError(req, &retryAfterError{delay: time.Hour})
+			Expect(rateLimiter.When(req)).To(Equal(2 * time.Second))
+		})
+		It("should drop the hint when an item is forgotten", func() {
+			rateLimiter := reasonable.NewRetryAfterRateLimiter(workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Millisecond, time.Second))
+			req := request("default", "test")
+			rateLimiter.ObserveError(req, &retryAfterError{delay: 5 * time.Second})
+			rateLimiter.Forget(req)
+			Expect(rateLimiter.When(req)).To(Equal(time.Millisecond))
+		})
+		It("should drop the hint when a later observation has none", func() {
+			rateLimiter := reasonable.NewRetryAfterRateLimiter(workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Millisecond, time.Second))
+			req := request("default", "test")
+			rateLimiter.ObserveError(req, &retryAfterError{delay: 5 * time.Second})
+			rateLimiter.ObserveError(req, nil)
+			Expect(rateLimiter.When(req)).To(Equal(time.Millisecond))
+			rateLimiter.ObserveError(req, &retryAfterError{delay: 5 * time.Second})
+			rateLimiter.ObserveError(req, errors.New("no hint"))
+			Expect(rateLimiter.When(req)).To(Equal(2 * time.Millisecond))
+		})
+		It("should extract retry-after hints from kubernetes errors", func() {
+			delay, ok := reasonable.RetryAfter(fmt.Errorf("listing pods, %w", apierrors.NewTooManyRequests("slow down", 3)))
+			Expect(ok).To(BeTrue())
+			Expect(delay).To(Equal(3 * time.Second))
+
+			_, ok = reasonable.RetryAfter(apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "test"))
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -4,14 +4,27 @@ import (
 	"context"
 	"time"
 
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/awslabs/operatorpkg/serrors"
 	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+const (
+	// HighPriority requeues a request ahead of regular work, e.g. when a dependency of the object just became ready
+	HighPriority = 100
+	// LowPriority requeues a request behind regular work, e.g. for background resyncs
+	LowPriority = handler.LowPriority
+)
+
 // Result adds Requeue functionality back to reconcile results.
 type Result struct {
 	RequeueAfter time.Duration
 	Requeue      bool
+	// Priority is the priority used if the request is requeued. It is only respected by controllers that use a
+	// priority queue, and the original priority of the request is preserved if unset.
+	Priority *int
 }
 
 // Reconciler defines the interface for standard reconcilers
@@ -19,11 +32,35 @@ type Reconciler interface {
 	Reconcile(ctx context.Context, req reconcile.Request) (Result, error)
 }
 
+// ErrorObserver is implemented by rate limiters that adjust their delays based on the errors returned by the reconciler,
+// e.g. reasonable.RetryAfterRateLimiter. ObserveError is called after every reconcile, with a nil error if the
+// reconcile didn't fail, so that observations don't outlive the reconcile that made them.
+type ErrorObserver interface {
+	ObserveError(req reconcile.Request, err error)
+}
+
+// Option configures the behavior of the reconciler adapters
+type Option struct {
+	// Name is the name of the controller, which labels the errors that the adapter counts in the error metric, see
+	// serrors.EnableMetrics
+	Name string
+	// OnTerminalError is called when the reconciler returns a terminal error, before the error is returned to
+	// controller-runtime. An error returned by it is retried in place of the terminal error.
+	OnTerminalError func(ctx context.Context, req reconcile.Request, err error) error
+}
+
+func WithName(name string) func(*Option) {
+	return func(o *Option) {
+		o.Name = name
+	}
+}
+
 // AsReconciler creates a reconciler with a default rate-limiter
-func AsReconciler(reconciler Reconciler) reconcile.Reconciler {
+func AsReconciler(reconciler Reconciler, opts ...option.Function[Option]) reconcile.Reconciler {
 	return AsReconcilerWithRateLimiter(
 		reconciler,
 		workqueue.DefaultTypedControllerRateLimiter[reconcile.Request](),
+		opts...,
 	)
 }
 
@@ -31,18 +68,36 @@ func AsReconciler(reconciler Reconciler) reconcile.Reconciler {
 func AsReconcilerWithRateLimiter(
 	reconciler Reconciler,
 	rateLimiter workqueue.TypedRateLimiter[reconcile.Request],
+	opts ...option.Function[Option],
 ) reconcile.Reconciler {
+	options := option.Resolve(opts...)
 	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 		result, err := reconciler.Reconcile(ctx, req)
+		if observer, ok := rateLimiter.(ErrorObserver); ok {
+			observer.ObserveError(req, err)
+		}
 		if err != nil {
+			// The error is counted once here, rather than when it's logged, as loggers don't have the controller name
+			err = serrors.ObserveError(err, "controller", options.Name)
+			if !IsTerminalError(err) {
+				return reconcile.Result{Priority: result.Priority}, err
+			}
+			// Terminal errors won't succeed on retry, so they're returned for controller-runtime to log and count without
+			// requeuing, and the request waits for the object to change
+			rateLimiter.Forget(req)
+			if options.OnTerminalError != nil {
+				if err := options.OnTerminalError(ctx, req, err); err != nil {
+					return reconcile.Result{}, err
+				}
+			}
 			return reconcile.Result{}, err
 		}
 		if result.RequeueAfter > 0 {
 			rateLimiter.Forget(req)
-			return reconcile.Result{RequeueAfter: result.RequeueAfter}, nil
+			return reconcile.Result{RequeueAfter: result.RequeueAfter, Priority: result.Priority}, nil
 		}
 		if result.Requeue {
-			return reconcile.Result{RequeueAfter: rateLimiter.When(req)}, nil
+			return reconcile.Result{RequeueAfter: rateLimiter.When(req), Priority: result.Priority}, nil
 		}
 		rateLimiter.Forget(req)
 		return reconcile.Result{}, nil
@@ -6,14 +6,36 @@ import (
 	"testing"
 	"time"
 
+	"github.com/awslabs/operatorpkg/reasonable"
 	"github.com/awslabs/operatorpkg/reconciler"
+	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/awslabs/operatorpkg/test"
+	. "github.com/awslabs/operatorpkg/test/expectations"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/samber/lo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+var (
+	SchemeBuilder = runtime.NewSchemeBuilder(func(scheme *runtime.Scheme) error {
+		scheme.AddKnownTypes(schema.GroupVersion{Group: test.APIGroup, Version: "v1alpha1"}, &test.CustomObject{})
+		return nil
+	})
+)
+
 func Test(t *testing.T) {
+	lo.Must0(SchemeBuilder.AddToScheme(scheme.Scheme))
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Reconciler")
 }
@@ -283,4 +305,172 @@ var _ = Describe("Reconciler", func() {
 		Expect(err2).NotTo(HaveOccurred())
 		Expect(result1.RequeueAfter).NotTo(Equal(result2.RequeueAfter))
 	})
+	It("should pass through the priority of the result when requeueing", func() {
+		for _, result := range []reconciler.Result{
+			{Priority: lo.ToPtr(reconciler.HighPriority), Requeue: true},
+			{Priority: lo.ToPtr(reconciler.HighPriority), RequeueAfter: 10 * time.Second},
+		} {
+			mockReconciler := &MockReconciler{result: result}
+
+			res, err := reconciler.AsReconciler(mockReconciler).Reconcile(context.Background(), reconcile.Request{})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Priority).To(HaveValue(Equal(reconciler.HighPriority)))
+		}
+	})
+	It("should pass through the priority of the result when an error is returned", func() {
+		mockReconciler := &MockReconciler{
+			result: reconciler.Result{Priority: lo.ToPtr(reconciler.LowPriority)},
+			err:    errors.New("test error"),
+		}
+
+		res, err := reconciler.AsReconciler(mockReconciler).Reconcile(context.Background(), reconcile.Request{})
+
+		Expect(err).To(HaveOccurred())
+		Expect(res.Priority).To(HaveValue(Equal(reconciler.LowPriority)))
+	})
+	It("should let the rate limiter observe returned errors", func() {
+		rateLimiter := reasonable.NewRetryAfterRateLimiter(workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Millisecond, time.Minute))
+		mockReconciler := &MockReconciler{
+			err: apierrors.NewTooManyRequests("slow down", 3),
+		}
+		req := reconcile.Request{}
+
+		_, err := reconciler.AsReconcilerWithRateLimiter(mockReconciler, rateLimiter).Reconcile(context.Background(), req)
+
+		Expect(err).To(HaveOccurred())
+		Expect(rateLimiter.When(req)).To(Equal(3 * time.Second))
+	})
+	It("should not apply the retry-after of an earlier error to a requeue", func() {
+		rateLimiter := reasonable.NewRetryAfterRateLimiter(workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Millisecond, time.Minute))
+		mockReconciler := &MockReconciler{
+			err: apierrors.NewTooManyRequests("slow down", 3),
+		}
+		req := reconcile.Request{}
+		adapter := reconciler.AsReconcilerWithRateLimiter(mockReconciler, rateLimiter)
+
+		// The rate limiter isn't the controller's, so the hint of the error is never consumed
+		_, err := adapter.Reconcile(context.Background(), req)
+		Expect(err).To(HaveOccurred())
+		mockReconciler.err, mockReconciler.result = nil, reconciler.Result{Requeue: true}
+		result, err := adapter.Reconcile(context.Background(), req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Millisecond))
+	})
+	Context("TerminalError", func() {
+		It("should return a terminal error to controller-runtime without requeuing", func() {
+			mockRateLimiter := &MockRateLimiter[reconcile.Request]{
+				backoffDuration: 10 * time.Second,
+			}
+			mockReconciler := &MockReconciler{
+				err: reconciler.TerminalError(errors.New("invalid spec")),
+			}
+			req := reconcile.Request{}
+			mockRateLimiter.When(req)
+
+			result, err := reconciler.AsReconcilerWithRateLimiter(mockReconciler, mockRateLimiter).Reconcile(context.Background(), req)
+
+			// controller-runtime doesn't requeue terminal errors, and counts them as terminal errors
+			Expect(errors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+			Expect(err).To(MatchError("terminal error: invalid spec"))
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(mockRateLimiter.NumRequeues(req)).To(Equal(0))
+		})
+		It("should recognize terminal errors wrapped with structured values", func() {
+			err := serrors.Wrap(reconciler.TerminalError(errors.New("invalid spec")), "key", "value")
+			Expect(reconciler.IsTerminalError(err)).To(BeTrue())
+			Expect(errors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+			Expect(serrors.UnwrapValues(err)).To(HaveExactElements("key", "value"))
+
+			err = reconciler.TerminalError(serrors.Wrap(errors.New("invalid spec"), "key", "value"))
+			Expect(reconciler.IsTerminalError(err)).To(BeTrue())
+			Expect(serrors.UnwrapValues(err)).To(HaveExactElements("key", "value"))
+			Expect(err.Error()).To(Equal("terminal error: invalid spec (key=value)"))
+		})
+		It("should recognize controller-runtime terminal errors", func() {
+			Expect(reconciler.IsTerminalError(reconcile.TerminalError(errors.New("invalid spec")))).To(BeTrue())
+			Expect(reconciler.IsTerminalError(errors.New("invalid spec"))).To(BeFalse())
+			Expect(reconciler.TerminalError(nil)).To(BeNil())
+		})
+		It("should set a condition on the object when a terminal error is returned", func() {
+			ctx := context.Background()
+			kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(&test.CustomObject{}).Build()
+			obj := test.Object(&test.CustomObject{})
+			ExpectApplied(ctx, kubeClient, obj)
+
+			mockReconciler := &MockReconciler{
+				err: reconciler.TerminalError(errors.New("invalid spec")),
+			}
+			_, err := reconciler.AsReconciler(mockReconciler, reconciler.WithTerminalCondition[*test.CustomObject](kubeClient, test.ConditionTypeFoo)).
+				Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+			Expect(reconciler.IsTerminalError(err)).To(BeTrue())
+
+			ExpectObject(ctx, kubeClient, obj)
+			condition := obj.StatusConditions().Get(test.ConditionTypeFoo)
+			Expect(condition.IsFalse()).To(BeTrue())
+			Expect(condition.Reason).To(Equal(reconciler.TerminalErrorReason))
+			Expect(condition.Message).To(Equal("terminal error: invalid spec"))
+		})
+	})
+	Context("ErrorMetrics", func() {
+		var registry *prometheus.Registry
+		BeforeEach(func() {
+			registry = prometheus.NewRegistry()
+			serrors.EnableMetrics(registry, "key", "controller")
+			DeferCleanup(serrors.DisableMetrics)
+		})
+		errorsTotal := func() float64 {
+			families, err := registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			return lo.SumBy(families, func(family *dto.MetricFamily) float64 {
+				return lo.SumBy(family.GetMetric(), func(metric *dto.Metric) float64 { return metric.GetCounter().GetValue() })
+			})
+		}
+		labelsOf := func() []map[string]string {
+			families, err := registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			return lo.FlatMap(families, func(family *dto.MetricFamily, _ int) []map[string]string {
+				return lo.Map(family.GetMetric(), func(metric *dto.Metric, _ int) map[string]string {
+					return lo.SliceToMap(metric.GetLabel(), func(label *dto.LabelPair) (string, string) { return label.GetName(), label.GetValue() })
+				})
+			})
+		}
+
+		It("should count returned errors", func() {
+			mockReconciler := &MockReconciler{err: serrors.Wrap(errors.New("test"), "key", "value")}
+			_, err := reconciler.AsReconciler(mockReconciler).Reconcile(context.Background(), reconcile.Request{})
+			Expect(err).To(HaveOccurred())
+			Expect(errorsTotal()).To(BeEquivalentTo(1))
+		})
+		It("should count terminal errors once", func() {
+			mockReconciler := &MockReconciler{err: reconciler.TerminalError(errors.New("test"))}
+			_, err := reconciler.AsReconciler(mockReconciler).Reconcile(context.Background(), reconcile.Request{})
+			Expect(reconciler.IsTerminalError(err)).To(BeTrue())
+			// controller-runtime logs terminal errors like any other returned error
+			serrors.NewLogger(GinkgoLogr).Error(err, "Reconciler error")
+			Expect(errorsTotal()).To(BeEquivalentTo(1))
+		})
+		It("should label returned errors with the name of the controller", func() {
+			mockReconciler := &MockReconciler{err: serrors.Wrap(errors.New("test"), "key", "value")}
+			_, err := reconciler.AsReconciler(mockReconciler, reconciler.WithName("test-controller")).Reconcile(context.Background(), reconcile.Request{})
+			Expect(err).To(HaveOccurred())
+			Expect(labelsOf()).To(ConsistOf(map[string]string{"controller": "test-controller", "key": "value", "category": "Unknown"}))
+		})
+		It("should label terminal errors with the name of the controller", func() {
+			mockReconciler := &MockReconciler{err: reconciler.TerminalError(errors.New("test"))}
+			_, err := reconciler.AsReconciler(mockReconciler, reconciler.WithName("test-controller")).Reconcile(context.Background(), reconcile.Request{})
+			Expect(reconciler.IsTerminalError(err)).To(BeTrue())
+			Expect(labelsOf()).To(ConsistOf(map[string]string{"controller": "test-controller", "key": "", "category": "Permanent"}))
+		})
+		It("should not count returned errors again when controller-runtime logs them", func() {
+			mockReconciler := &MockReconciler{err: errors.New("test")}
+			_, err := reconciler.AsReconciler(mockReconciler, reconciler.WithName("test-controller")).Reconcile(context.Background(), reconcile.Request{})
+			Expect(err).To(HaveOccurred())
+			// controller-runtime logs returned errors with a logger that has the name of the controller
+			serrors.NewLogger(GinkgoLogr).WithValues("controller", "other").Error(err, "Reconciler error")
+			Expect(errorsTotal()).To(BeEquivalentTo(1))
+			Expect(labelsOf()).To(ConsistOf(HaveKeyWithValue("controller", "test-controller")))
+			Expect(err).To(MatchError("test"))
+		})
+	})
 })
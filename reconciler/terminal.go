@@ -0,0 +1,70 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/awslabs/operatorpkg/object"
+	"github.com/awslabs/operatorpkg/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// TerminalErrorReason is the condition reason used when a terminal error is surfaced on an object
+const TerminalErrorReason = "TerminalError"
+
+// terminalError marks an error as permanent, i.e. retrying won't succeed until the object changes
+type terminalError struct {
+	error
+}
+
+// TerminalError wraps an error to signal that the reconcile shouldn't be retried until the object changes.
+// It composes with serrors.Wrap in either order, and is also recognized by controller-runtime as a reconcile.TerminalError
+func TerminalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &terminalError{error: err}
+}
+
+// Unwrap returns the unwrapped error
+func (e *terminalError) Unwrap() error {
+	return e.error
+}
+
+// Error returns the string representation of the error
+func (e *terminalError) Error() string {
+	return fmt.Sprintf("terminal error: %s", e.error.Error())
+}
+
+// Is allows controller-runtime to treat this error as a reconcile.TerminalError
+func (e *terminalError) Is(target error) bool {
+	return errors.Is(reconcile.TerminalError(nil), target)
+}
+
+// IsTerminalError returns true if any error in the chain is a terminal error, including controller-runtime terminal errors
+func IsTerminalError(err error) bool {
+	return errors.Is(err, reconcile.TerminalError(nil))
+}
+
+// WithTerminalCondition sets conditionType to False with the terminal error's message when a terminal error is returned.
+// The condition is left untouched once the object changes, so reconcilers are responsible for setting it back to True
+func WithTerminalCondition[T status.Object](kubeClient client.Client, conditionType string) func(*Option) {
+	return func(o *Option) {
+		o.OnTerminalError = func(ctx context.Context, req reconcile.Request, err error) error {
+			obj := object.New[T]()
+			if err := kubeClient.Get(ctx, req.NamespacedName, obj); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			stored := obj.DeepCopyObject().(T)
+			if !obj.StatusConditions().SetFalse(conditionType, TerminalErrorReason, err.Error()) {
+				return nil
+			}
+			if err := kubeClient.Status().Patch(ctx, obj, client.MergeFrom(stored)); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package serrors
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/awslabs/operatorpkg/env"
+)
+
+// CallerKey is the reserved key that the location of Wrap is surfaced under by UnwrapValues. It's distinct from the
+// "caller" key that loggers use for the location of the log call, e.g. zap with AddCaller.
+const CallerKey = "error-caller"
+
+// Capture determines what Wrap records about where an error was wrapped
+type Capture string
+
+const (
+	// CaptureNone doesn't record anything, and is the default
+	CaptureNone Capture = "none"
+	// CaptureCaller records the file and line that called Wrap, e.g. controllers/node.go:42
+	CaptureCaller Capture = "caller"
+	// CaptureStack records a compact stack of the function names and lines leading to Wrap, e.g.
+	// node.(*Controller).Reconcile:42 < reconciler.AsReconcilerWithRateLimiter.func1:65
+	CaptureStack Capture = "stack"
+)
+
+// maxStackDepth bounds the size of captured stacks
+const maxStackDepth = 8
+
+// capture is initialized from the SERRORS_CAPTURE environment variable, e.g. SERRORS_CAPTURE=caller
+var capture atomic.Value
+
+func init() {
+	SetCapture(Capture(env.WithDefaultString("SERRORS_CAPTURE", string(CaptureNone))))
+}
+
+// SetCapture sets what Wrap records about where errors are wrapped. Capturing has a cost on every call to Wrap, so
+// it's intended to be enabled while debugging.
+func SetCapture(c Capture) {
+	capture.Store(c)
+}
+
+// caller returns the location of the caller of the function that calls caller, or an empty string if capture is
+// disabled
+func caller() string {
+	switch capture.Load().(Capture) {
+	case CaptureCaller:
+		_, file, line, ok := runtime.Caller(2)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%s:%d", path.Join(path.Base(path.Dir(file)), path.Base(file)), line)
+	case CaptureStack:
+		pcs := make([]uintptr, maxStackDepth)
+		frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+		var elems []string
+		for {
+			frame, more := frames.Next()
+			// Trim the package path, e.g. github.com/awslabs/operatorpkg/serrors.Wrap becomes serrors.Wrap
+			elems = append(elems, fmt.Sprintf("%s:%d", path.Base(frame.Function), frame.Line))
+			if !more || strings.HasPrefix(frame.Function, "runtime.") {
+				break
+			}
+		}
+		return strings.Join(elems, " < ")
+	}
+	return ""
+}
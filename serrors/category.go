@@ -0,0 +1,72 @@
+package serrors
+
+import (
+	"context"
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// CategoryKey is the structured key that a Category is stored under
+const CategoryKey = "category"
+
+// Category is a stable classification of an error, so that reconcilers, retries and metrics can handle errors without
+// knowing where they came from. Categories are attached with Wrap, e.g. serrors.Wrap(err, serrors.CategoryKey,
+// serrors.Throttled), and errors.Is(err, serrors.Throttled) returns true for the wrapped error.
+type Category string
+
+const (
+	// Unknown is returned by Classify when an error can't be classified
+	Unknown Category = "Unknown"
+	// NotFound means the resource doesn't exist
+	NotFound Category = "NotFound"
+	// Conflict means the resource was modified concurrently or already exists
+	Conflict Category = "Conflict"
+	// Throttled means the request was rate limited and should be retried after a delay
+	Throttled Category = "Throttled"
+	// Invalid means the request was rejected and won't succeed until it changes
+	Invalid Category = "Invalid"
+	// Transient means the request failed temporarily and may succeed on retry
+	Transient Category = "Transient"
+	// Permanent means the request won't succeed on retry, e.g. it isn't authorized
+	Permanent Category = "Permanent"
+)
+
+// Error allows categories to be used as errors.Is targets
+func (c Category) Error() string {
+	return string(c)
+}
+
+// Classify returns the category of the error. Categories attached with Wrap take precedence, with the outermost
+// category winning, followed by the categories of Kubernetes API errors, terminal reconcile errors and context
+// deadlines. Unknown is returned for errors that can't be classified.
+func Classify(err error) Category {
+	if err == nil {
+		return Unknown
+	}
+	for chain, e := err, (*Error)(nil); errors.As(chain, &e); chain = e.Unwrap() {
+		if c, ok := e.keysAndValues[CategoryKey].(Category); ok {
+			return c
+		}
+	}
+	switch {
+	case apierrors.IsNotFound(err), apierrors.IsGone(err):
+		return NotFound
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return Conflict
+	case apierrors.IsTooManyRequests(err):
+		return Throttled
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err), apierrors.IsRequestEntityTooLargeError(err):
+		return Invalid
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err), apierrors.IsMethodNotSupported(err), apierrors.IsNotAcceptable(err), apierrors.IsUnsupportedMediaType(err):
+		return Permanent
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return Transient
+	case errors.Is(err, reconcile.TerminalError(nil)):
+		return Permanent
+	case errors.Is(err, context.DeadlineExceeded):
+		return Transient
+	}
+	return Unknown
+}
@@ -0,0 +1,157 @@
+// Package client wraps controller-runtime clients so that the errors returned by the API server are structured errors
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/awslabs/operatorpkg/serrors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	KubeVerbLogKey             = "kube-verb"
+	KubeGroupVersionKindLogKey = "kube-gvk"
+	KubeNamespaceLogKey        = "kube-namespace"
+	KubeNameLogKey             = "kube-name"
+	KubeSubResourceLogKey      = "kube-subresource"
+	KubeStatusCodeLogKey       = "kube-status-code"
+	KubeReasonLogKey           = "kube-reason"
+	KubeRetryAfterLogKey       = "kube-retry-after"
+)
+
+// New wraps a client.Client so that the API errors it returns, e.g. apierrors.StatusError, are structured errors
+// with the verb, the kind, namespace and name of the object, and the status code, reason and retry-after of the
+// response. Errors that didn't come from the API server are returned as is, and errors.Is and apierrors.IsNotFound
+// still match the wrapped errors.
+func New(c client.Client) client.Client {
+	return &kubeClient{Client: c}
+}
+
+type kubeClient struct {
+	client.Client
+}
+
+func (c *kubeClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.wrap(c.Client.Get(ctx, key, obj, opts...), "get", c.gvk(obj), key.Namespace, key.Name)
+}
+
+func (c *kubeClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.wrap(c.Client.List(ctx, list, opts...), "list", c.gvk(list), (&client.ListOptions{}).ApplyOptions(opts).Namespace, "")
+}
+
+func (c *kubeClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return c.wrap(c.Client.Create(ctx, obj, opts...), "create", c.gvk(obj), obj.GetNamespace(), obj.GetName())
+}
+
+func (c *kubeClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return c.wrap(c.Client.Delete(ctx, obj, opts...), "delete", c.gvk(obj), obj.GetNamespace(), obj.GetName())
+}
+
+func (c *kubeClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return c.wrap(c.Client.DeleteAllOf(ctx, obj, opts...), "deletecollection", c.gvk(obj), (&client.DeleteAllOfOptions{}).ApplyOptions(opts).Namespace, "")
+}
+
+func (c *kubeClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.wrap(c.Client.Update(ctx, obj, opts...), "update", c.gvk(obj), obj.GetNamespace(), obj.GetName())
+}
+
+func (c *kubeClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.wrap(c.Client.Patch(ctx, obj, patch, opts...), "patch", c.gvk(obj), obj.GetNamespace(), obj.GetName())
+}
+
+func (c *kubeClient) Apply(ctx context.Context, obj runtime.ApplyConfiguration, opts ...client.ApplyOption) error {
+	gvk, namespace, name := describeApplyConfiguration(obj)
+	return c.wrap(c.Client.Apply(ctx, obj, opts...), "apply", gvk, namespace, name)
+}
+
+func (c *kubeClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *kubeClient) SubResource(subResource string) client.SubResourceClient {
+	return &kubeSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), client: c, subResource: subResource}
+}
+
+// gvk returns the GroupVersionKind of the object, or an empty GroupVersionKind if it isn't registered with the scheme
+func (c *kubeClient) gvk(obj runtime.Object) schema.GroupVersionKind {
+	gvk, _ := c.GroupVersionKindFor(obj)
+	return gvk
+}
+
+// wrap returns a structured error for API errors
+func (c *kubeClient) wrap(err error, verb string, gvk schema.GroupVersionKind, namespace, name string, keysAndValues ...any) error {
+	var status apierrors.APIStatus
+	if err == nil || !errors.As(err, &status) {
+		return err
+	}
+	values := append([]any{KubeVerbLogKey, verb}, keysAndValues...)
+	if !gvk.Empty() {
+		values = append(values, KubeGroupVersionKindLogKey, gvk.String())
+	}
+	if namespace != "" {
+		values = append(values, KubeNamespaceLogKey, namespace)
+	}
+	if name != "" {
+		values = append(values, KubeNameLogKey, name)
+	}
+	if code := status.Status().Code; code != 0 {
+		values = append(values, KubeStatusCodeLogKey, code)
+	}
+	if reason := status.Status().Reason; reason != "" {
+		values = append(values, KubeReasonLogKey, reason)
+	}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+		values = append(values, KubeRetryAfterLogKey, time.Duration(seconds)*time.Second)
+	}
+	return serrors.Wrap(err, values...)
+}
+
+type kubeSubResourceClient struct {
+	client.SubResourceClient
+	client      *kubeClient
+	subResource string
+}
+
+func (c *kubeSubResourceClient) Get(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceGetOption) error {
+	return c.client.wrap(c.SubResourceClient.Get(ctx, obj, subResource, opts...), "get", c.client.gvk(obj), obj.GetNamespace(), obj.GetName(), KubeSubResourceLogKey, c.subResource)
+}
+
+func (c *kubeSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return c.client.wrap(c.SubResourceClient.Create(ctx, obj, subResource, opts...), "create", c.client.gvk(obj), obj.GetNamespace(), obj.GetName(), KubeSubResourceLogKey, c.subResource)
+}
+
+func (c *kubeSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return c.client.wrap(c.SubResourceClient.Update(ctx, obj, opts...), "update", c.client.gvk(obj), obj.GetNamespace(), obj.GetName(), KubeSubResourceLogKey, c.subResource)
+}
+
+func (c *kubeSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return c.client.wrap(c.SubResourceClient.Patch(ctx, obj, patch, opts...), "patch", c.client.gvk(obj), obj.GetNamespace(), obj.GetName(), KubeSubResourceLogKey, c.subResource)
+}
+
+func (c *kubeSubResourceClient) Apply(ctx context.Context, obj runtime.ApplyConfiguration, opts ...client.SubResourceApplyOption) error {
+	gvk, namespace, name := describeApplyConfiguration(obj)
+	return c.client.wrap(c.SubResourceClient.Apply(ctx, obj, opts...), "apply", gvk, namespace, name, KubeSubResourceLogKey, c.subResource)
+}
+
+// describeApplyConfiguration returns the kind, namespace and name of generated apply configurations, which expose
+// them through getters
+func describeApplyConfiguration(obj runtime.ApplyConfiguration) (gvk schema.GroupVersionKind, namespace, name string) {
+	if o, ok := obj.(interface {
+		GetAPIVersion() *string
+		GetKind() *string
+	}); ok && o.GetAPIVersion() != nil && o.GetKind() != nil {
+		gvk = schema.FromAPIVersionAndKind(*o.GetAPIVersion(), *o.GetKind())
+	}
+	if o, ok := obj.(interface{ GetNamespace() *string }); ok && o.GetNamespace() != nil {
+		namespace = *o.GetNamespace()
+	}
+	if o, ok := obj.(interface{ GetName() *string }); ok && o.GetName() != nil {
+		name = *o.GetName()
+	}
+	return gvk, namespace, name
+}
@@ -0,0 +1,94 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/awslabs/operatorpkg/serrors"
+	serrorsclient "github.com/awslabs/operatorpkg/serrors/client"
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ctx context.Context
+var kubeClient client.Client
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Structured Errors Client")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = log.IntoContext(context.Background(), ginkgo.GinkgoLogr)
+})
+
+var _ = Describe("Client", func() {
+	BeforeEach(func() {
+		kubeClient = serrorsclient.New(fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				return apierrors.NewTooManyRequests("slow down", 5)
+			},
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				return fmt.Errorf("connection refused")
+			},
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				return apierrors.NewConflict(schema.GroupResource{Resource: "pods"}, obj.GetName(), fmt.Errorf("modified"))
+			},
+		}).Build())
+	})
+	It("should add the request and response to API errors", func() {
+		err := kubeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "test"}, &corev1.Pod{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(serrors.Classify(err)).To(Equal(serrors.NotFound))
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements(
+			serrorsclient.KubeGroupVersionKindLogKey, "/v1, Kind=Pod",
+			serrorsclient.KubeNameLogKey, "test",
+			serrorsclient.KubeNamespaceLogKey, "default",
+			serrorsclient.KubeReasonLogKey, metav1.StatusReasonNotFound,
+			serrorsclient.KubeStatusCodeLogKey, int32(404),
+			serrorsclient.KubeVerbLogKey, "get",
+		))
+	})
+	It("should add the retry-after of throttled requests", func() {
+		err := kubeClient.List(ctx, &corev1.PodList{}, client.InNamespace("default"))
+		Expect(serrors.Classify(err)).To(Equal(serrors.Throttled))
+		values := valuesOf(err)
+		Expect(values).To(HaveKeyWithValue(serrorsclient.KubeVerbLogKey, "list"))
+		Expect(values).To(HaveKeyWithValue(serrorsclient.KubeNamespaceLogKey, "default"))
+		Expect(values).To(HaveKeyWithValue(serrorsclient.KubeRetryAfterLogKey, 5*time.Second))
+		Expect(values).ToNot(HaveKey(serrorsclient.KubeNameLogKey))
+	})
+	It("should add the subresource to API errors", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+		err := kubeClient.Status().Patch(ctx, pod, client.MergeFrom(pod.DeepCopy()))
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+		values := valuesOf(err)
+		Expect(values).To(HaveKeyWithValue(serrorsclient.KubeVerbLogKey, "patch"))
+		Expect(values).To(HaveKeyWithValue(serrorsclient.KubeSubResourceLogKey, "status"))
+		Expect(values).To(HaveKeyWithValue(serrorsclient.KubeStatusCodeLogKey, int32(409)))
+	})
+	It("should not wrap errors that didn't come from the API server", func() {
+		err := kubeClient.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}})
+		Expect(err).To(MatchError("connection refused"))
+		Expect(serrors.UnwrapValues(err)).To(BeEmpty())
+	})
+	It("should not wrap successful requests", func() {
+		Expect(kubeClient.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}})).To(Succeed())
+	})
+})
+
+func valuesOf(err error) map[string]any {
+	return lo.SliceToMap(lo.Chunk(serrors.UnwrapValues(err), 2), func(kv []any) (string, any) { return kv[0].(string), kv[1] })
+}
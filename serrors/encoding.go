@@ -0,0 +1,97 @@
+package serrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"github.com/samber/lo"
+)
+
+// MarshalJSON serializes the message, the structured values and the wrapped cause chain of the error, e.g.
+// {"message":"getting pod, not found","values":{"name":"test"},"cause":{"message":"not found"}}
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode(e))
+}
+
+// LogValue allows log/slog to log the message, the structured values and the wrapped cause chain of the error
+func (e *Error) LogValue() slog.Value {
+	return logValue(encode(e))
+}
+
+// encodedError is the serializable representation of an error and its cause chain
+type encodedError struct {
+	Message string          `json:"message"`
+	Values  map[string]any  `json:"values,omitempty"`
+	Caller  string          `json:"caller,omitempty"`
+	Cause   *encodedError   `json:"cause,omitempty"`
+	Errors  []*encodedError `json:"errors,omitempty"`
+}
+
+func encode(err error) *encodedError {
+	if err == nil {
+		return nil
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		encoded := &encodedError{Message: err.Error()}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			encoded.Errors = lo.Map(joined.Unwrap(), func(err error, _ int) *encodedError { return encode(err) })
+		} else {
+			encoded.Cause = encode(errors.Unwrap(err))
+		}
+		return encoded
+	}
+	// The structured values are encoded separately, so the message is the message of the wrapped error
+	encoded := encode(e.error)
+	if encoded == nil {
+		encoded = &encodedError{}
+	}
+	if _, nested := e.error.(*Error); nested {
+		encoded = &encodedError{Message: message(e.error), Cause: encoded}
+	}
+	encoded.Caller = e.caller
+	encoded.Values = lo.MapValues(e.keysAndValues, func(v any, k string) any {
+		v = Redact(k, v)
+		// Values that can't be serialized, e.g. functions, are formatted instead
+		if _, err := json.Marshal(v); err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return v
+	})
+	return encoded
+}
+
+// message returns the message of the error without the structured values
+func message(err error) string {
+	if e, ok := err.(*Error); ok {
+		return message(e.error)
+	}
+	return err.Error()
+}
+
+func logValue(encoded *encodedError) slog.Value {
+	attrs := []slog.Attr{slog.String("message", encoded.Message)}
+	if len(encoded.Values) > 0 {
+		keys := lo.Keys(encoded.Values)
+		sort.Strings(keys) // sort keys so we always get a consistent ordering
+		attrs = append(attrs, slog.Attr{Key: "values", Value: slog.GroupValue(lo.Map(keys, func(k string, _ int) slog.Attr {
+			return slog.Any(k, encoded.Values[k])
+		})...)})
+	}
+	if encoded.Caller != "" {
+		attrs = append(attrs, slog.String("caller", encoded.Caller))
+	}
+	if encoded.Cause != nil {
+		attrs = append(attrs, slog.Attr{Key: "cause", Value: logValue(encoded.Cause)})
+	}
+	if len(encoded.Errors) > 0 {
+		attrs = append(attrs, slog.Attr{Key: "errors", Value: slog.GroupValue(lo.Map(encoded.Errors, func(e *encodedError, i int) slog.Attr {
+			return slog.Attr{Key: strconv.Itoa(i), Value: logValue(e)}
+		})...)})
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -1,17 +1,27 @@
 package serrors
 
-import "github.com/go-logr/logr"
+import (
+	"slices"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/go-logr/logr"
+)
 
 // Logger is a structured error logger that can be used as a wrapper for other logr.Loggers
-// It unwraps the values for structured errors and calls WithValues() for them
+// It unwraps the values for structured errors and calls WithValues() for them, applying the redaction policy to every value
 type Logger struct {
 	name string
 	sink logr.LogSink
+	// values are the keys and values of the logger, which label the error metric
+	values []any
+	// opts configure how the values of structured errors are unwrapped
+	opts []option.Function[Option]
 }
 
-// NewLogger creates a new log logr.Logger using the serrors.Logger
-func NewLogger(logger logr.Logger) logr.Logger {
-	return logr.New(&Logger{sink: logger.GetSink()})
+// NewLogger creates a new log logr.Logger using the serrors.Logger, the options configure how the values of
+// structured errors are unwrapped, e.g. serrors.WithMergeStrategy(serrors.DedupeSet)
+func NewLogger(logger logr.Logger, opts ...option.Function[Option]) logr.Logger {
+	return logr.New(&Logger{sink: logger.GetSink(), opts: opts})
 }
 
 func (l *Logger) Init(ri logr.RuntimeInfo) {
@@ -23,17 +33,18 @@ func (l *Logger) Enabled(level int) bool {
 }
 
 func (l *Logger) Info(level int, msg string, keysAndValues ...interface{}) {
-	l.sink.Info(level, msg, keysAndValues...)
+	l.sink.Info(level, msg, redactKeysAndValues(keysAndValues)...)
 }
 
 func (l *Logger) Error(err error, msg string, keysAndValues ...interface{}) {
-	l.sink.Error(err, msg, append(keysAndValues, UnwrapValues(err)...)...)
+	ObserveError(err, append(keysAndValues, l.values...)...)
+	l.sink.Error(err, msg, append(redactKeysAndValues(keysAndValues), UnwrapValues(err, l.opts...)...)...)
 }
 
 func (l *Logger) WithValues(keysAndValues ...interface{}) logr.LogSink {
-	return &Logger{name: l.name, sink: l.sink.WithValues(keysAndValues...)}
+	return &Logger{name: l.name, sink: l.sink.WithValues(redactKeysAndValues(keysAndValues)...), values: append(slices.Clip(l.values), keysAndValues...), opts: l.opts}
 }
 
 func (l *Logger) WithName(name string) logr.LogSink {
-	return &Logger{name: name, sink: l.sink.WithName(name)}
+	return &Logger{name: name, sink: l.sink.WithName(name), values: l.values, opts: l.opts}
 }
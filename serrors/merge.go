@@ -0,0 +1,93 @@
+package serrors
+
+import (
+	"fmt"
+
+	"github.com/samber/lo"
+)
+
+// MergeStrategy combines the values of a key that appears in several errors of an error tree into a single key and
+// value. Values are ordered from the outermost error to the innermost, and from the first joined error to the last.
+type MergeStrategy func(key string, values []any) (string, any)
+
+// FirstWins keeps the value of the outermost error
+func FirstWins(key string, values []any) (string, any) {
+	return key, values[0]
+}
+
+// LastWins keeps the value of the innermost error
+func LastWins(key string, values []any) (string, any) {
+	return key, values[len(values)-1]
+}
+
+// Slice combines every value into a slice under the pluralized key, e.g. "keys", and is the default
+func Slice(key string, values []any) (string, any) {
+	if len(values) == 1 {
+		return key, values[0]
+	}
+	return fmt.Sprintf("%ss", key), values
+}
+
+// DedupeSet combines the distinct values into a slice under the pluralized key, e.g. "keys". Values are compared by
+// their formatted representation, so values that can't be compared are also deduplicated.
+func DedupeSet(key string, values []any) (string, any) {
+	return Slice(key, lo.UniqBy(values, func(v any) string { return fmt.Sprintf("%#v", v) }))
+}
+
+// Option configures how UnwrapValues combines the values of an error tree
+type Option struct {
+	// MergeStrategy combines the values of keys that appear in several errors, defaults to Slice
+	MergeStrategy MergeStrategy
+	// MaxValues bounds the number of values that are collected for each key, defaults to 100
+	MaxValues int
+	// MaxErrors bounds the number of errors that are visited in the error tree, defaults to 1000
+	MaxErrors int
+}
+
+func WithMergeStrategy(strategy MergeStrategy) func(*Option) {
+	return func(o *Option) {
+		o.MergeStrategy = strategy
+	}
+}
+
+func WithMaxValues(maxValues int) func(*Option) {
+	return func(o *Option) {
+		o.MaxValues = maxValues
+	}
+}
+
+func WithMaxErrors(maxErrors int) func(*Option) {
+	return func(o *Option) {
+		o.MaxErrors = maxErrors
+	}
+}
+
+func (o *Option) resolve() *Option {
+	o.MergeStrategy = lo.Ternary(o.MergeStrategy == nil, Slice, o.MergeStrategy)
+	o.MaxValues = lo.Ternary(o.MaxValues <= 0, 100, o.MaxValues)
+	o.MaxErrors = lo.Ternary(o.MaxErrors <= 0, 1000, o.MaxErrors)
+	return o
+}
+
+// walk visits the errors of the error tree in depth first order, following both Unwrap() error and
+// Unwrap() []error, e.g. errors.Join and multierr. It stops after visiting maxErrors errors.
+func walk(err error, maxErrors int, visit func(error)) {
+	stack := []error{err}
+	for visited := 0; len(stack) > 0 && visited < maxErrors; visited++ {
+		err, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if err == nil {
+			continue
+		}
+		visit(err)
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			children := e.Unwrap()
+			// Push the children in reverse so that they're visited in order
+			for i := len(children) - 1; i >= 0; i-- {
+				stack = append(stack, children[i])
+			}
+		case interface{ Unwrap() error }:
+			stack = append(stack, e.Unwrap())
+		}
+	}
+}
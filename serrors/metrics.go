@@ -0,0 +1,103 @@
+package serrors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	pmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+)
+
+// MetricLabelCategory is the label of the error metric that is always set to the category of the error
+const MetricLabelCategory = "category"
+
+type errorMetrics struct {
+	// keys maps the allowlisted structured keys to their label names
+	keys    map[string]string
+	counter pmetrics.CounterMetric
+}
+
+var metrics atomic.Pointer[errorMetrics]
+
+var invalidLabelCharacters = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// EnableMetrics counts the errors that are logged through Logger or returned through the reconciler adapters in
+// operator_errors_total. The values of the allowlisted structured keys become labels, so the allowlist bounds the
+// cardinality of the metric, and keys are converted to valid label names, e.g. aws-service-name becomes
+// aws_service_name. The metric is registered with the registry, so it must only be enabled once per registry.
+func EnableMetrics(registry prometheus.Registerer, keys ...string) {
+	m := &errorMetrics{keys: map[string]string{}}
+	for _, key := range keys {
+		m.keys[key] = invalidLabelCharacters.ReplaceAllString(key, "_")
+	}
+	m.counter = pmetrics.NewPrometheusCounter(
+		registry,
+		prometheus.CounterOpts{
+			Namespace: pmetrics.Namespace,
+			Name:      "errors_total",
+			Help:      "The number of errors that were logged or returned by reconcilers, labeled by their category and allowlisted structured values.",
+		},
+		lo.Uniq(append(lo.Values(m.keys), MetricLabelCategory)),
+	)
+	metrics.Store(m)
+}
+
+// DisableMetrics stops counting errors, e.g. to restore the default between tests. The metric stays registered with
+// the registry, so it can't be enabled again with the same registry.
+func DisableMetrics() {
+	metrics.Store(nil)
+}
+
+// ObserveError increments the error metric, if metrics are enabled. The keys and values supplement the structured
+// values of the error, e.g. with the values of a logger, but the values of the error take precedence. It returns the
+// error marked as observed, which isn't counted again, e.g. when controller-runtime logs an error returned by a
+// reconciler through a Logger. Errors are returned unchanged if metrics aren't enabled.
+func ObserveError(err error, keysAndValues ...any) error {
+	m := metrics.Load()
+	if m == nil || err == nil || errors.As(err, new(*observedError)) {
+		return err
+	}
+	labels := lo.MapEntries(m.keys, func(_ string, label string) (string, string) { return label, "" })
+	for key, value := range firstValues(err, keysAndValues) {
+		if label, ok := m.keys[key]; ok {
+			labels[label] = fmt.Sprint(Redact(key, value))
+		}
+	}
+	labels[MetricLabelCategory] = string(Classify(err))
+	m.counter.Inc(labels)
+	return &observedError{error: err}
+}
+
+// observedError is an error that was counted by ObserveError
+type observedError struct {
+	error
+}
+
+func (e *observedError) Unwrap() error {
+	return e.error
+}
+
+// firstValues returns the outermost value of every structured key in the error, falling back to the keys and values
+func firstValues(err error, keysAndValues []any) map[string]any {
+	values := map[string]any{}
+	walk(err, (&Option{}).resolve().MaxErrors, func(err error) {
+		if e, ok := err.(*Error); ok {
+			for k, v := range e.keysAndValues {
+				if _, ok := values[k]; !ok {
+					values[k] = v
+				}
+			}
+		}
+	})
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if k, ok := keysAndValues[i].(string); ok {
+			if _, ok := values[k]; !ok {
+				values[k] = keysAndValues[i+1]
+			}
+		}
+	}
+	return values
+}
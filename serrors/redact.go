@@ -0,0 +1,84 @@
+package serrors
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"slices"
+	"sync/atomic"
+)
+
+// Redactable is implemented by values that control how they're rendered in errors and logs, e.g. an ARN that masks
+// its account ID. Redactable values are always rendered as the value returned by Redacted.
+type Redactable interface {
+	Redacted() any
+}
+
+// RedactionPolicy determines which structured values are replaced with a placeholder, e.g. [REDACTED string], when
+// errors are formatted, unwrapped, serialized or logged. The placeholder records the type of the value, so it's clear
+// that a value was present and removed on purpose.
+type RedactionPolicy struct {
+	// Keys redacts the values of keys that match any of the patterns
+	Keys []*regexp.Regexp
+	// Types redacts values of any of the types
+	Types []reflect.Type
+}
+
+// DefaultRedactionPolicy redacts values with keys that commonly hold credentials
+var DefaultRedactionPolicy = RedactionPolicy{
+	Keys: []*regexp.Regexp{regexp.MustCompile(`(?i)(password|passwd|secret|token|credential|authorization|api[-_]?key|private[-_]?key|session)`)},
+}
+
+var policy atomic.Pointer[RedactionPolicy]
+
+func init() {
+	SetRedactionPolicy(DefaultRedactionPolicy)
+}
+
+// SetRedactionPolicy replaces the redaction policy. Policies should extend DefaultRedactionPolicy rather than replace
+// it, unless the default keys are known to be safe.
+func SetRedactionPolicy(p RedactionPolicy) {
+	policy.Store(&RedactionPolicy{Keys: slices.Clone(p.Keys), Types: slices.Clone(p.Types)})
+}
+
+// Redact returns the value that is rendered for the key under the redaction policy
+func Redact(key string, value any) any {
+	v, _ := redact(key, value)
+	return v
+}
+
+// redact returns the value that is rendered for the key, and whether it differs from the value
+func redact(key string, value any) (any, bool) {
+	if r, ok := value.(Redactable); ok {
+		return r.Redacted(), true
+	}
+	p := policy.Load()
+	if slices.ContainsFunc(p.Keys, func(pattern *regexp.Regexp) bool { return pattern.MatchString(key) }) ||
+		(value != nil && slices.Contains(p.Types, reflect.TypeOf(value))) {
+		return fmt.Sprintf("[REDACTED %T]", value), true
+	}
+	return value, false
+}
+
+// redactKeysAndValues applies the redaction policy to a list of keys and values
+func redactKeysAndValues(keysAndValues []any) []any {
+	redacted := slices.Clone(keysAndValues)
+	for i := 0; i+1 < len(redacted); i += 2 {
+		if key, ok := redacted[i].(string); ok {
+			redacted[i+1] = Redact(key, redacted[i+1])
+		}
+	}
+	return redacted
+}
+
+// redactAttr applies the redaction policy to a slog attribute
+func redactAttr(a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if v, ok := redact(a.Key, a.Value.Any()); ok {
+		return slog.Any(a.Key, v)
+	}
+	return a
+}
@@ -6,14 +6,25 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/awslabs/operatorpkg/option"
 	"github.com/samber/lo"
-	"go.uber.org/multierr"
 )
 
-// Error is a structured error that stores structured errors and values alongside the error
+// Error is a structured error that stores structured errors and values alongside the error. Errors are immutable, so
+// they can be shared between goroutines and used as sentinels.
 type Error struct {
 	error
 	keysAndValues map[string]any
+	// caller is where the error was wrapped, if capture is enabled
+	caller string
+	// parent is the error that WithValues was called on, so that errors.Is matches it
+	parent *Error
+}
+
+// New returns a structured error with the message and structured keys and values. Sentinel errors created with New
+// still match errors.Is after call sites add values with WithValues.
+func New(message string, keysAndValues ...any) *Error {
+	return newError(errors.New(message), caller(), keysAndValues)
 }
 
 // Unwrap returns the unwrapped error
@@ -23,32 +34,57 @@ func (e *Error) Unwrap() error {
 
 // Error returns the string representation of the error
 func (e *Error) Error() string {
+	if len(e.keysAndValues) == 0 {
+		return e.error.Error()
+	}
 	var elems []string
 	keys := lo.Keys(e.keysAndValues)
 	sort.Strings(keys) // sort keys so we always get a consistent ordering
 	for _, k := range keys {
-		v := e.keysAndValues[k]
+		v := Redact(k, e.keysAndValues[k])
 		elems = append(elems, fmt.Sprintf("%s=%v", k, v))
 	}
 	return fmt.Sprintf("%s (%s)", e.error.Error(), strings.Join(elems, ", "))
 }
 
-// WithValues injects additional structured keys and values into the error
-func (e *Error) WithValues(keysAndValues ...any) *Error {
-	lo.Must0(validateKeysAndValues(keysAndValues))
-	if e.keysAndValues == nil {
-		e.keysAndValues = map[string]any{}
+// Is returns true if the target is the category of the error, or the error that WithValues was called on to create it
+func (e *Error) Is(target error) bool {
+	if c, ok := target.(Category); ok {
+		return e.keysAndValues[CategoryKey] == c
 	}
-	for i := 0; i < len(keysAndValues); i += 2 {
-		e.keysAndValues[keysAndValues[i].(string)] = keysAndValues[i+1]
+	for p := e.parent; p != nil; p = p.parent {
+		if target == error(p) {
+			return true
+		}
 	}
-	return e
+	return false
+}
+
+// WithValues returns a copy of the error with additional structured keys and values. The copy wraps the same error
+// as the receiver, and the receiver is left unchanged.
+func (e *Error) WithValues(keysAndValues ...any) *Error {
+	child := newError(e.error, lo.CoalesceOrEmpty(caller(), e.caller), keysAndValues)
+	for k, v := range e.keysAndValues {
+		if _, ok := child.keysAndValues[k]; !ok {
+			child.keysAndValues[k] = v
+		}
+	}
+	child.parent = e
+	return child
 }
 
 // Wrap wraps and existing error with additional structured keys and values
 func Wrap(err error, keysAndValues ...any) error {
-	e := &Error{error: err}
-	return e.WithValues(keysAndValues...)
+	return newError(err, caller(), keysAndValues)
+}
+
+func newError(err error, caller string, keysAndValues []any) *Error {
+	lo.Must0(validateKeysAndValues(keysAndValues))
+	e := &Error{error: err, keysAndValues: make(map[string]any, len(keysAndValues)/2), caller: caller}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		e.keysAndValues[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	return e
 }
 
 func validateKeysAndValues(keysAndValues []any) error {
@@ -63,35 +99,47 @@ func validateKeysAndValues(keysAndValues []any) error {
 	return nil
 }
 
-// UnwrapValues returns a combined set of keys and values from every wrapped error
-func UnwrapValues(err error) (res []any) {
+// UnwrapValues returns a combined set of keys and values from every error in the error tree, including errors joined
+// with errors.Join or multierr. Keys that appear in several errors are combined by the merge strategy, and the
+// number of values is bounded so that deeply nested aggregations don't produce unbounded log lines.
+func UnwrapValues(err error, opts ...option.Function[Option]) (res []any) {
+	options := option.Resolve(opts...).resolve()
 	values := map[string][]any{}
-	for err != nil {
-		for _, elem := range multierr.Errors(err) {
-			if e, ok := elem.(*Error); ok {
-				for k, v := range e.keysAndValues {
-					if _, mOk := values[k]; mOk {
-						values[k] = append(values[k], v)
-					} else {
-						values[k] = []any{v}
-					}
-				}
-			}
+	truncated := map[string]int{}
+	add := func(k string, v any) {
+		if len(values[k]) >= options.MaxValues {
+			truncated[k]++
+			return
 		}
-		err = errors.Unwrap(err)
+		values[k] = append(values[k], v)
 	}
+	walk(err, options.MaxErrors, func(err error) {
+		e, ok := err.(*Error)
+		if !ok {
+			return
+		}
+		if e.caller != "" {
+			add(CallerKey, e.caller)
+		}
+		keys := lo.Keys(e.keysAndValues)
+		sort.Strings(keys) // sort keys so that truncation is consistent
+		for _, k := range keys {
+			add(k, Redact(k, e.keysAndValues[k]))
+		}
+	})
 	if len(values) == 0 {
 		return nil
 	}
 	keys := lo.Keys(values)
 	sort.Strings(keys) // sort keys so we always get a consistent ordering
 	for _, k := range keys {
-		v := values[k]
-		if len(v) == 1 {
-			res = append(res, k, v[0])
-		} else {
-			res = append(res, fmt.Sprintf("%ss", k), v)
+		key, value := options.MergeStrategy(k, values[k])
+		if truncated[k] > 0 {
+			if slice, ok := value.([]any); ok {
+				value = append(slice, fmt.Sprintf("+%d more", truncated[k]))
+			}
 		}
+		res = append(res, key, value)
 	}
 	return res
 }
@@ -0,0 +1,53 @@
+package serrors
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/samber/lo"
+)
+
+// SlogHandler is a structured error handler that can be used as a wrapper for other slog.Handlers. Like Logger, it
+// unwraps the values of structured errors into attributes of the record, logs errors as their message, and applies the
+// redaction policy to attributes.
+type SlogHandler struct {
+	handler slog.Handler
+	opts    []option.Function[Option]
+}
+
+// NewSlogHandler creates a new slog.Handler using the serrors.SlogHandler, the options configure how the values of
+// structured errors are unwrapped
+func NewSlogHandler(handler slog.Handler, opts ...option.Function[Option]) *SlogHandler {
+	return &SlogHandler{handler: handler, opts: opts}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	r := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		if err, ok := a.Value.Any().(error); ok && a.Value.Kind() != slog.KindGroup {
+			errs = append(errs, err)
+			a = slog.String(a.Key, err.Error())
+		}
+		r.AddAttrs(redactAttr(a))
+		return true
+	})
+	for _, err := range errs {
+		ObserveError(err)
+		r.Add(UnwrapValues(err, h.opts...)...)
+	}
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SlogHandler{handler: h.handler.WithAttrs(lo.Map(attrs, func(a slog.Attr, _ int) slog.Attr { return redactAttr(a) })), opts: h.opts}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	return &SlogHandler{handler: h.handler.WithGroup(name), opts: h.opts}
+}
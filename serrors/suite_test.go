@@ -1,23 +1,34 @@
 package serrors_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/go-logr/logr/funcr"
 	"github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/samber/lo"
 	"go.uber.org/multierr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var ctx context.Context
-var kubeClient client.Client
 
 func Test(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -77,3 +88,403 @@ var _ = Describe("Structured Errors", func() {
 		Expect(values).To(ContainElements("keys", "wrappedKey1", "wrappedKey2"))
 	})
 })
+
+var _ = Describe("Categories", func() {
+	It("should match categories attached with Wrap using errors.Is", func() {
+		err := serrors.Wrap(fmt.Errorf("test"), serrors.CategoryKey, serrors.Throttled)
+		Expect(errors.Is(err, serrors.Throttled)).To(BeTrue())
+		Expect(errors.Is(err, serrors.NotFound)).To(BeFalse())
+		Expect(errors.Is(fmt.Errorf("wrapped, %w", err), serrors.Throttled)).To(BeTrue())
+		Expect(err.Error()).To(Equal("test (category=Throttled)"))
+	})
+	It("should classify the outermost category", func() {
+		err := serrors.Wrap(fmt.Errorf("test"), serrors.CategoryKey, serrors.Transient)
+		err = serrors.Wrap(fmt.Errorf("wrapped, %w", err), "key", "value")
+		Expect(serrors.Classify(err)).To(Equal(serrors.Transient))
+		err = serrors.Wrap(fmt.Errorf("wrapped, %w", err), serrors.CategoryKey, serrors.Permanent)
+		Expect(serrors.Classify(err)).To(Equal(serrors.Permanent))
+	})
+	It("should classify categories inside a multierr", func() {
+		err := multierr.Append(fmt.Errorf("test"), serrors.Wrap(fmt.Errorf("test"), serrors.CategoryKey, serrors.Conflict))
+		Expect(serrors.Classify(err)).To(Equal(serrors.Conflict))
+		Expect(errors.Is(err, serrors.Conflict)).To(BeTrue())
+	})
+	It("should prefer an attached category over the category of the wrapped error", func() {
+		err := serrors.Wrap(apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "test"), serrors.CategoryKey, serrors.Permanent)
+		Expect(serrors.Classify(err)).To(Equal(serrors.Permanent))
+	})
+	DescribeTable("should classify errors",
+		func(err error, category serrors.Category) {
+			Expect(serrors.Classify(err)).To(Equal(category))
+			// Classification works through wrapping
+			Expect(serrors.Classify(serrors.Wrap(fmt.Errorf("wrapped, %w", err), "key", "value"))).To(Equal(category))
+		},
+		Entry("not found", apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "test"), serrors.NotFound),
+		Entry("conflict", apierrors.NewConflict(schema.GroupResource{Resource: "pods"}, "test", fmt.Errorf("modified")), serrors.Conflict),
+		Entry("already exists", apierrors.NewAlreadyExists(schema.GroupResource{Resource: "pods"}, "test"), serrors.Conflict),
+		Entry("too many requests", apierrors.NewTooManyRequests("slow down", 1), serrors.Throttled),
+		Entry("invalid", apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, "test", nil), serrors.Invalid),
+		Entry("bad request", apierrors.NewBadRequest("bad"), serrors.Invalid),
+		Entry("forbidden", apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "test", fmt.Errorf("denied")), serrors.Permanent),
+		Entry("internal error", apierrors.NewInternalError(fmt.Errorf("internal")), serrors.Transient),
+		Entry("service unavailable", apierrors.NewServiceUnavailable("unavailable"), serrors.Transient),
+		Entry("terminal error", reconcile.TerminalError(fmt.Errorf("terminal")), serrors.Permanent),
+		Entry("deadline exceeded", context.DeadlineExceeded, serrors.Transient),
+		Entry("unknown", fmt.Errorf("test"), serrors.Unknown),
+	)
+	It("should classify nil as unknown", func() {
+		Expect(serrors.Classify(nil)).To(Equal(serrors.Unknown))
+	})
+})
+
+var _ = Describe("Metrics", func() {
+	var registry *prometheus.Registry
+	BeforeEach(func() {
+		registry = prometheus.NewRegistry()
+		serrors.EnableMetrics(registry, "aws-service-name", "controller")
+		DeferCleanup(serrors.DisableMetrics)
+	})
+	errorsTotal := func(labels map[string]string) float64 {
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "operator_errors_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				if lo.EveryBy(metric.GetLabel(), func(label *dto.LabelPair) bool { return labels[label.GetName()] == label.GetValue() }) {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	It("should label errors with allowlisted structured values", func() {
+		err := serrors.Wrap(fmt.Errorf("test"), "aws-service-name", "EC2", "instance-id", "i-123", serrors.CategoryKey, serrors.Throttled)
+		serrors.ObserveError(err)
+		serrors.ObserveError(err)
+		Expect(errorsTotal(map[string]string{"aws_service_name": "EC2", "controller": "", "category": "Throttled"})).To(BeEquivalentTo(2))
+	})
+	It("should prefer the outermost value of a key", func() {
+		err := serrors.Wrap(fmt.Errorf("test"), "controller", "inner")
+		err = serrors.Wrap(fmt.Errorf("wrapped, %w", err), "controller", "outer")
+		serrors.ObserveError(err, "controller", "logger")
+		Expect(errorsTotal(map[string]string{"aws_service_name": "", "controller": "outer", "category": "Unknown"})).To(BeEquivalentTo(1))
+	})
+	It("should count errors logged through the logger with the values of the logger", func() {
+		logger := serrors.NewLogger(ginkgo.GinkgoLogr).WithValues("controller", "test")
+		logger.Error(serrors.Wrap(fmt.Errorf("test"), "aws-service-name", "EC2"), "failed")
+		Expect(errorsTotal(map[string]string{"aws_service_name": "EC2", "controller": "test", "category": "Unknown"})).To(BeEquivalentTo(1))
+	})
+	It("should not count observed errors again", func() {
+		err := serrors.ObserveError(fmt.Errorf("test"), "controller", "test")
+		serrors.NewLogger(ginkgo.GinkgoLogr).Error(err, "failed")
+		serrors.ObserveError(fmt.Errorf("wrapped, %w", err))
+		Expect(errorsTotal(map[string]string{"aws_service_name": "", "controller": "test", "category": "Unknown"})).To(BeEquivalentTo(1))
+		Expect(err).To(MatchError("test"))
+	})
+	It("should stop counting errors once disabled", func() {
+		serrors.DisableMetrics()
+		err := fmt.Errorf("test")
+		Expect(serrors.ObserveError(err, "controller", "test")).To(BeIdenticalTo(err))
+		families, gatherErr := registry.Gather()
+		Expect(gatherErr).ToNot(HaveOccurred())
+		Expect(families).To(BeEmpty())
+	})
+	It("should not count nil errors", func() {
+		serrors.ObserveError(nil)
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Encoding", func() {
+	It("should marshal the message, values and cause chain to JSON", func() {
+		err := serrors.Wrap(fmt.Errorf("getting pod, %w", errors.New("not found")), "name", "test")
+		raw, marshalErr := json.Marshal(err)
+		Expect(marshalErr).ToNot(HaveOccurred())
+		Expect(string(raw)).To(MatchJSON(`{"message":"getting pod, not found","values":{"name":"test"},"cause":{"message":"not found"}}`))
+	})
+	It("should marshal nested structured errors", func() {
+		inner := serrors.Wrap(errors.New("not found"), "name", "test")
+		err := serrors.Wrap(fmt.Errorf("getting pod, %w", inner), "namespace", "default")
+		raw, marshalErr := json.Marshal(err)
+		Expect(marshalErr).ToNot(HaveOccurred())
+		Expect(string(raw)).To(MatchJSON(`{
+			"message": "getting pod, not found (name=test)",
+			"values": {"namespace": "default"},
+			"cause": {"message": "not found", "values": {"name": "test"}}
+		}`))
+
+		raw, marshalErr = json.Marshal(serrors.Wrap(inner, "namespace", "default"))
+		Expect(marshalErr).ToNot(HaveOccurred())
+		Expect(string(raw)).To(MatchJSON(`{
+			"message": "not found",
+			"values": {"namespace": "default"},
+			"cause": {"message": "not found", "values": {"name": "test"}}
+		}`))
+	})
+	It("should marshal joined errors", func() {
+		err := serrors.Wrap(multierr.Append(errors.New("first"), serrors.Wrap(errors.New("second"), "key", "value")), "outer", "value")
+		raw, marshalErr := json.Marshal(err)
+		Expect(marshalErr).ToNot(HaveOccurred())
+		Expect(string(raw)).To(MatchJSON(`{
+			"message": "first; second (key=value)",
+			"values": {"outer": "value"},
+			"errors": [{"message": "first"}, {"message": "second", "values": {"key": "value"}}]
+		}`))
+	})
+	It("should format values that can't be marshaled", func() {
+		raw, err := json.Marshal(serrors.Wrap(errors.New("test"), "channel", make(chan int)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(raw)).To(ContainSubstring(`"channel":"0x`))
+	})
+	It("should log the message, values and cause chain with slog", func() {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+		logger.Error("failed", "error", serrors.Wrap(fmt.Errorf("getting pod, %w", errors.New("not found")), "name", "test"))
+		entry := map[string]any{}
+		Expect(json.Unmarshal(buf.Bytes(), &entry)).To(Succeed())
+		Expect(entry["error"]).To(Equal(map[string]any{
+			"message": "getting pod, not found",
+			"values":  map[string]any{"name": "test"},
+			"cause":   map[string]any{"message": "not found"},
+		}))
+	})
+	It("should unwrap structured values with the slog handler", func() {
+		buf := &bytes.Buffer{}
+		logger := slog.New(serrors.NewSlogHandler(slog.NewJSONHandler(buf, nil))).With("controller", "test")
+		logger.Error("failed", "error", serrors.Wrap(errors.New("not found"), "name", "test"))
+		entry := map[string]any{}
+		Expect(json.Unmarshal(buf.Bytes(), &entry)).To(Succeed())
+		Expect(entry).To(HaveKeyWithValue("error", "not found (name=test)"))
+		Expect(entry).To(HaveKeyWithValue("name", "test"))
+		Expect(entry).To(HaveKeyWithValue("controller", "test"))
+		Expect(entry).To(HaveKeyWithValue("msg", "failed"))
+	})
+})
+
+var _ = Describe("Caller", func() {
+	AfterEach(func() {
+		serrors.SetCapture(serrors.CaptureNone)
+	})
+
+	It("should not capture the caller by default", func() {
+		err := serrors.Wrap(errors.New("test"), "key", "value")
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("key", "value"))
+	})
+	It("should capture the caller of Wrap", func() {
+		serrors.SetCapture(serrors.CaptureCaller)
+		err := serrors.Wrap(errors.New("test"), "key", "value")
+		values := serrors.UnwrapValues(err)
+		Expect(values).To(HaveExactElements(serrors.CallerKey, MatchRegexp(`^serrors/suite_test\.go:\d+$`), "key", "value"))
+		// The caller doesn't change the message of the error
+		Expect(err.Error()).To(Equal("test (key=value)"))
+	})
+	It("should capture a compact stack", func() {
+		serrors.SetCapture(serrors.CaptureStack)
+		err := wrapInHelper(errors.New("test"))
+		values := serrors.UnwrapValues(err)
+		Expect(values).To(HaveLen(2))
+		Expect(values[1]).To(MatchRegexp(`^serrors_test\.wrapInHelper:\d+ < serrors_test\.init\.func\d+\.\d+:\d+ < `))
+	})
+	It("should aggregate the callers of a multierr", func() {
+		serrors.SetCapture(serrors.CaptureCaller)
+		err := multierr.Append(serrors.Wrap(errors.New("first")), wrapInHelper(errors.New("second")))
+		values := serrors.UnwrapValues(err)
+		Expect(values).To(HaveLen(2))
+		Expect(values[0]).To(Equal(serrors.CallerKey + "s"))
+		Expect(values[1]).To(HaveLen(2))
+	})
+	It("should render the caller with the logger", func() {
+		serrors.SetCapture(serrors.CaptureCaller)
+		var line string
+		logger := serrors.NewLogger(funcr.New(func(prefix, args string) { line = args }, funcr.Options{}))
+		logger.Error(serrors.Wrap(errors.New("test")), "failed")
+		Expect(line).To(MatchRegexp(`"error-caller"="serrors/suite_test\.go:\d+"`))
+	})
+	It("should serialize the caller", func() {
+		serrors.SetCapture(serrors.CaptureCaller)
+		raw, err := json.Marshal(serrors.Wrap(errors.New("test")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(raw)).To(MatchRegexp(`"caller":"serrors/suite_test\.go:\d+"`))
+	})
+})
+
+func wrapInHelper(err error) error {
+	return serrors.Wrap(err)
+}
+
+type Credentials struct {
+	AccessKeyID string
+}
+
+type ARN string
+
+func (a ARN) Redacted() any {
+	return "arn:aws:iam::***:role/test"
+}
+
+var _ = Describe("Redaction", func() {
+	BeforeEach(func() {
+		serrors.SetRedactionPolicy(serrors.RedactionPolicy{
+			Keys:  serrors.DefaultRedactionPolicy.Keys,
+			Types: []reflect.Type{reflect.TypeOf(Credentials{})},
+		})
+		DeferCleanup(serrors.SetRedactionPolicy, serrors.DefaultRedactionPolicy)
+	})
+
+	It("should redact values by key", func() {
+		err := serrors.Wrap(errors.New("test"), "session-token", "abc123", "name", "test")
+		Expect(err.Error()).To(Equal("test (name=test, session-token=[REDACTED string])"))
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("name", "test", "session-token", "[REDACTED string]"))
+	})
+	It("should redact values by type", func() {
+		err := serrors.Wrap(errors.New("test"), "creds", Credentials{AccessKeyID: "AKIA"})
+		Expect(err.Error()).To(Equal("test (creds=[REDACTED serrors_test.Credentials])"))
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("creds", "[REDACTED serrors_test.Credentials]"))
+	})
+	It("should render redactable values", func() {
+		err := serrors.Wrap(errors.New("test"), "role", ARN("arn:aws:iam::123456789012:role/test"))
+		Expect(err.Error()).To(Equal("test (role=arn:aws:iam::***:role/test)"))
+	})
+	It("should redact aggregated values", func() {
+		err := multierr.Append(
+			serrors.Wrap(errors.New("first"), "token", "abc"),
+			serrors.Wrap(errors.New("second"), "token", "def"),
+		)
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("tokens", []any{"[REDACTED string]", "[REDACTED string]"}))
+	})
+	It("should redact serialized values", func() {
+		raw, err := json.Marshal(serrors.Wrap(errors.New("test"), "password", "hunter2"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(raw)).ToNot(ContainSubstring("hunter2"))
+		Expect(string(raw)).To(ContainSubstring("[REDACTED string]"))
+	})
+	It("should redact values passed to the logger", func() {
+		var line string
+		logger := serrors.NewLogger(funcr.New(func(prefix, args string) { line = args }, funcr.Options{})).WithValues("api-key", "abc")
+		logger.Error(serrors.Wrap(errors.New("test"), "secret", "def"), "failed", "authorization", "Bearer ghi")
+		Expect(line).ToNot(ContainSubstring("abc"))
+		Expect(line).ToNot(ContainSubstring("def"))
+		Expect(line).ToNot(ContainSubstring("ghi"))
+		Expect(line).To(ContainSubstring(`"secret"="[REDACTED string]"`))
+	})
+	It("should redact attributes with the slog handler", func() {
+		buf := &bytes.Buffer{}
+		logger := slog.New(serrors.NewSlogHandler(slog.NewJSONHandler(buf, nil))).With("token", "abc")
+		logger.Error("failed", "error", serrors.Wrap(errors.New("test"), "password", "def"), "count", 1)
+		Expect(buf.String()).ToNot(ContainSubstring("abc"))
+		Expect(buf.String()).ToNot(ContainSubstring("def"))
+		Expect(buf.String()).To(ContainSubstring(`"count":1`))
+	})
+})
+
+var ErrNotFound = serrors.New("not found", "kind", "Pod")
+
+var _ = Describe("Immutability", func() {
+	It("should not modify the receiver of WithValues", func() {
+		first := ErrNotFound.WithValues("name", "first")
+		second := ErrNotFound.WithValues("name", "second")
+		Expect(ErrNotFound.Error()).To(Equal("not found (kind=Pod)"))
+		Expect(first.Error()).To(Equal("not found (kind=Pod, name=first)"))
+		Expect(second.Error()).To(Equal("not found (kind=Pod, name=second)"))
+	})
+	It("should match sentinels with errors.Is", func() {
+		err := fmt.Errorf("getting pod, %w", ErrNotFound.WithValues("name", "test").WithValues("namespace", "default"))
+		Expect(errors.Is(err, ErrNotFound)).To(BeTrue())
+		Expect(errors.Is(err, serrors.New("not found"))).To(BeFalse())
+		Expect(errors.Is(ErrNotFound, ErrNotFound)).To(BeTrue())
+	})
+	It("should override values of the parent", func() {
+		err := ErrNotFound.WithValues("kind", "Node")
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("kind", "Node"))
+	})
+	It("should render errors without values as their message", func() {
+		Expect(serrors.New("not found").Error()).To(Equal("not found"))
+	})
+	It("should share sentinels between goroutines", func() {
+		wg := sync.WaitGroup{}
+		for i := range 100 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				err := ErrNotFound.WithValues("name", fmt.Sprintf("pod-%d", i))
+				Expect(err.Error()).To(Equal(fmt.Sprintf("not found (kind=Pod, name=pod-%d)", i)))
+			}()
+		}
+		wg.Wait()
+		Expect(ErrNotFound.Error()).To(Equal("not found (kind=Pod)"))
+	})
+	It("should pluralize values of sentinels in a multierr", func() {
+		var err error
+		for i := range 3 {
+			err = multierr.Append(err, ErrNotFound.WithValues("name", fmt.Sprintf("pod-%d", i)))
+		}
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("kinds", []any{"Pod", "Pod", "Pod"}, "names", []any{"pod-0", "pod-1", "pod-2"}))
+	})
+})
+
+var _ = Describe("Merging", func() {
+	var err error
+	BeforeEach(func() {
+		err = errors.Join(
+			serrors.Wrap(fmt.Errorf("test error 0"), "key", "a"),
+			fmt.Errorf("wrapped, %w", errors.Join(
+				serrors.Wrap(fmt.Errorf("test error 1"), "key", "b"),
+				serrors.Wrap(fmt.Errorf("test error 2"), "key", "a"),
+			)),
+		)
+	})
+	It("should traverse errors.Join trees", func() {
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("keys", []any{"a", "b", "a"}))
+	})
+	It("should traverse custom errors that unwrap to multiple errors", func() {
+		err := serrors.Wrap(joinedError{serrors.Wrap(fmt.Errorf("test error 0"), "key", "a"), serrors.Wrap(fmt.Errorf("test error 1"), "key", "b")}, "outer", "value")
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("keys", []any{"a", "b"}, "outer", "value"))
+	})
+	DescribeTable("should merge duplicate keys with the strategy",
+		func(strategy serrors.MergeStrategy, expected ...any) {
+			Expect(serrors.UnwrapValues(err, serrors.WithMergeStrategy(strategy))).To(HaveExactElements(expected...))
+		},
+		Entry("FirstWins", serrors.FirstWins, "key", "a"),
+		Entry("LastWins", serrors.LastWins, "key", "a"),
+		Entry("Slice", serrors.Slice, "keys", []any{"a", "b", "a"}),
+		Entry("DedupeSet", serrors.DedupeSet, "keys", []any{"a", "b"}),
+	)
+	It("should not pluralize keys with a single distinct value", func() {
+		err := errors.Join(serrors.Wrap(fmt.Errorf("test error 0"), "key", "a"), serrors.Wrap(fmt.Errorf("test error 1"), "key", "a"))
+		Expect(serrors.UnwrapValues(err, serrors.WithMergeStrategy(serrors.DedupeSet))).To(HaveExactElements("key", "a"))
+	})
+	It("should bound the number of values of a key", func() {
+		var errs []error
+		for i := range 100 {
+			errs = append(errs, serrors.Wrap(fmt.Errorf("test error %d", i), "key", i))
+		}
+		values := serrors.UnwrapValues(errors.Join(errs...), serrors.WithMaxValues(3))
+		Expect(values).To(HaveExactElements("keys", []any{0, 1, 2, "+97 more"}))
+	})
+	It("should bound the number of errors that are visited", func() {
+		err := serrors.Wrap(fmt.Errorf("test error"), "key", "inner")
+		for range 10 {
+			err = errors.Join(err)
+		}
+		Expect(serrors.UnwrapValues(err, serrors.WithMaxErrors(5))).To(BeEmpty())
+		Expect(serrors.UnwrapValues(err)).To(HaveExactElements("key", "inner"))
+	})
+	It("should merge with the strategy of the logger", func() {
+		var line string
+		logger := serrors.NewLogger(funcr.New(func(prefix, args string) { line = args }, funcr.Options{}), serrors.WithMergeStrategy(serrors.FirstWins))
+		logger.WithValues("controller", "test").Error(err, "failed")
+		Expect(line).To(ContainSubstring(`"key"="a"`))
+		Expect(line).ToNot(ContainSubstring(`"keys"`))
+	})
+})
+
+type joinedError []error
+
+func (e joinedError) Error() string   { return errors.Join(e...).Error() }
+func (e joinedError) Unwrap() []error { return e }
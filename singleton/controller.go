@@ -4,8 +4,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/awslabs/operatorpkg/option"
 	"github.com/awslabs/operatorpkg/reconciler"
 	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -18,6 +20,18 @@ const (
 	RequeueImmediately = 1 * time.Nanosecond
 )
 
+// Option configures the singleton source
+type Option struct {
+	// Priority is the priority of the request when the controller uses a priority queue
+	Priority *int
+}
+
+func WithPriority(priority int) func(*Option) {
+	return func(o *Option) {
+		o.Priority = &priority
+	}
+}
+
 // Reconciler defines the interface for singleton reconcilers
 type Reconciler interface {
 	Reconcile(ctx context.Context) (reconciler.Result, error)
@@ -35,18 +49,32 @@ func (r *reconcilerAdapter) Reconcile(ctx context.Context, _ reconcile.Request)
 // This implements the same behavior as Requeue: True.
 
 // AsReconciler creates a controller-runtime reconciler from a singleton reconciler
-func AsReconciler(rec Reconciler) reconcile.Reconciler {
+func AsReconciler(rec Reconciler, opts ...option.Function[reconciler.Option]) reconcile.Reconciler {
 	adapter := &reconcilerAdapter{Reconciler: rec}
-	return reconciler.AsReconciler(adapter)
+	return reconciler.AsReconciler(adapter, opts...)
 }
 
 // Source creates a source for singleton controllers
-func Source() source.Source {
+func Source(opts ...option.Function[Option]) source.Source {
+	options := option.Resolve(opts...)
 	eventSource := make(chan event.GenericEvent, 1)
 	eventSource <- event.GenericEvent{}
 	return source.Channel(eventSource, handler.Funcs{
 		GenericFunc: func(_ context.Context, _ event.GenericEvent, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
-			queue.Add(reconcile.Request{})
+			enqueue(queue, 0, options.Priority)
 		},
 	})
 }
+
+// enqueue adds the singleton request to the queue after the delay, using the priority if the queue supports it
+func enqueue(queue workqueue.TypedRateLimitingInterface[reconcile.Request], after time.Duration, priority *int) {
+	if pq, ok := queue.(priorityqueue.PriorityQueue[reconcile.Request]); ok && priority != nil {
+		pq.AddWithOpts(priorityqueue.AddOpts{After: after, Priority: priority}, reconcile.Request{})
+		return
+	}
+	if after > 0 {
+		queue.AddAfter(reconcile.Request{}, after)
+		return
+	}
+	queue.Add(reconcile.Request{})
+}
@@ -0,0 +1,286 @@
+package singleton
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/awslabs/operatorpkg/reconciler"
+	"github.com/samber/lo"
+	"k8s.io/utils/clock"
+)
+
+// Schedule is a parsed cron schedule in the standard five field format: minute, hour, day of month, month and day
+// of week. Fields support lists, ranges, steps and names, and the schedule may be prefixed with CRON_TZ=<zone> or
+// replaced by one of the @yearly, @monthly, @weekly, @daily and @hourly descriptors.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// If either day field is unrestricted, both day fields must match. Otherwise, either day field may match.
+	domStar, dowStar bool
+	location         *time.Location
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = bounds{min: 0, max: 59}
+	hourBounds   = bounds{min: 0, max: 23}
+	domBounds    = bounds{min: 1, max: 31}
+	monthBounds  = bounds{min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week allows 7 as an alias for Sunday
+	dowBounds = bounds{min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a cron schedule, evaluating it in the location unless the schedule specifies CRON_TZ
+func ParseSchedule(spec string, location *time.Location) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		zone, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(zone, "=")
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("loading location %q, %w", name, err)
+		}
+		location, spec = loc, strings.TrimSpace(rest)
+	}
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d in %q", len(fields), spec)
+	}
+	s := &Schedule{
+		location: lo.Ternary(location == nil, time.UTC, location),
+		domStar:  fields[2] == "*" || fields[2] == "?",
+		dowStar:  fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	for i, f := range []struct {
+		bits   *uint64
+		bounds bounds
+	}{{&s.minute, minuteBounds}, {&s.hour, hourBounds}, {&s.dom, domBounds}, {&s.month, monthBounds}, {&s.dow, dowBounds}} {
+		if *f.bits, err = parseField(fields[i], f.bounds); err != nil {
+			return nil, fmt.Errorf("parsing %q, %w", fields[i], err)
+		}
+	}
+	// Fold Sunday as 7 into Sunday as 0
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parseField returns a bitset of the values of a comma separated list of ranges
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := uint(1)
+		if hasStep {
+			n, err := strconv.ParseUint(stepStr, 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = uint(n)
+		}
+		var lower, upper uint
+		switch {
+		case rng == "*" || rng == "?":
+			lower, upper = b.min, b.max
+		case strings.Contains(rng, "-"):
+			l, u, _ := strings.Cut(rng, "-")
+			var err error
+			if lower, err = parseValue(l, b); err != nil {
+				return 0, err
+			}
+			if upper, err = parseValue(u, b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseValue(rng, b)
+			if err != nil {
+				return 0, err
+			}
+			// A single value with a step, e.g. 5/15, runs from the value to the end of the range
+			lower, upper = v, lo.Ternary(hasStep, b.max, v)
+		}
+		if lower > upper {
+			return 0, fmt.Errorf("invalid range %q", rng)
+		}
+		for v := lower; v <= upper; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return uint(v), nil
+}
+
+// Next returns the first fire time of the schedule after t, or the zero time if the schedule never fires
+func (s *Schedule) Next(t time.Time) time.Time {
+	original := t.Location()
+	t = t.In(s.location)
+	// Start at the next whole minute, resetting the lower fields whenever a higher field is incremented
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.location).Add(time.Minute)
+	limit := t.Year() + 5 // Schedules such as Feb 30th never fire
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// Adding durations rather than rebuilding the date steps over DST transitions
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t.In(original)
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// CronOption configures cron reconcilers
+type CronOption struct {
+	// Location is the time zone used to evaluate schedules that don't specify one. Defaults to UTC
+	Location *time.Location
+	// LastSuccess returns the time of the last successful run, e.g. from the status of a custom resource, or the zero
+	// time if it has never succeeded. It's used to catch up on a run that was missed before the reconciler started.
+	LastSuccess func(context.Context) (time.Time, error)
+	Clock       clock.Clock
+}
+
+func WithLocation(location *time.Location) func(*CronOption) {
+	return func(o *CronOption) {
+		o.Location = location
+	}
+}
+
+func WithLastSuccess(lastSuccess func(context.Context) (time.Time, error)) func(*CronOption) {
+	return func(o *CronOption) {
+		o.LastSuccess = lastSuccess
+	}
+}
+
+func WithCronClock(clk clock.Clock) func(*CronOption) {
+	return func(o *CronOption) {
+		o.Clock = clk
+	}
+}
+
+// CronReconciler runs a singleton reconciler at the fire times of a cron schedule. It's intended to be registered
+// with Source and AsReconciler: it computes the RequeueAfter until the next fire time, and only runs the wrapped
+// reconciler once a fire time has passed. Failed runs are retried with backoff until they succeed, and the results
+// of the wrapped reconciler are otherwise ignored.
+//
+// The next fire time is only kept in memory, so by default fire times that pass while no replica is running the
+// reconciler, e.g. during a restart or a leader failover, are skipped. Reconcilers that must not skip a run should
+// persist the time of their last success and configure WithLastSuccess, in which case a single missed run is caught
+// up on as soon as the reconciler starts.
+type CronReconciler struct {
+	name        string
+	schedule    *Schedule
+	reconciler  Reconciler
+	lastSuccess func(context.Context) (time.Time, error)
+	clock       clock.Clock
+
+	mu       sync.Mutex
+	nextFire time.Time
+}
+
+func NewCronReconciler(name string, schedule string, reconciler Reconciler, opts ...option.Function[CronOption]) (*CronReconciler, error) {
+	options := option.Resolve(opts...)
+	s, err := ParseSchedule(schedule, options.Location)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schedule for %s, %w", name, err)
+	}
+	return &CronReconciler{
+		name:        name,
+		schedule:    s,
+		reconciler:  reconciler,
+		lastSuccess: options.LastSuccess,
+		clock:       lo.Ternary[clock.Clock](options.Clock == nil, clock.RealClock{}, options.Clock),
+	}, nil
+}
+
+func (c *CronReconciler) Reconcile(ctx context.Context) (reconciler.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if c.nextFire.IsZero() {
+		from := now
+		if c.lastSuccess != nil {
+			lastSuccess, err := c.lastSuccess(ctx)
+			if err != nil {
+				return reconciler.Result{}, fmt.Errorf("getting last success of %s, %w", c.name, err)
+			}
+			// A fire time after the last success that has already passed was missed, so it runs immediately
+			from = lo.Ternary(lastSuccess.IsZero(), now, lastSuccess)
+		}
+		if c.nextFire = c.schedule.Next(from); c.nextFire.IsZero() {
+			return reconciler.Result{}, nil
+		}
+	}
+	if !now.Before(c.nextFire) {
+		result, err := c.reconciler.Reconcile(ctx)
+		if err != nil {
+			return reconciler.Result{Priority: result.Priority}, err
+		}
+		now = c.clock.Now()
+		LastSuccessTimestampSeconds.Set(float64(now.Unix()), map[string]string{MetricLabelController: c.name})
+		c.nextFire = c.schedule.Next(now)
+	}
+	if c.nextFire.IsZero() {
+		return reconciler.Result{}, nil
+	}
+	return reconciler.Result{RequeueAfter: c.nextFire.Sub(now)}, nil
+}
@@ -0,0 +1,49 @@
+package singleton
+
+import (
+	pmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	MetricSubsystem       = "singleton"
+	MetricLabelController = "controller"
+)
+
+// Cardinality is limited to # singletons
+var MissedTicksTotal = pmetrics.NewPrometheusCounter(
+	metrics.Registry,
+	prometheus.CounterOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "missed_ticks_total",
+		Help:      "The number of scheduled runs of a singleton that were dropped, either because a previous run was still in progress or because the schedule fell behind.",
+	},
+	[]string{MetricLabelController},
+)
+
+// Cardinality is limited to # singletons
+var TickDelay = pmetrics.NewPrometheusHistogram(
+	metrics.Registry,
+	prometheus.HistogramOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "tick_delay_seconds",
+		Help:      "The amount of time between when a singleton run was scheduled and when it started. e.g. Alarm := P99(tick_delay_seconds) > interval",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	},
+	[]string{MetricLabelController},
+)
+
+// Cardinality is limited to # singletons
+var LastSuccessTimestampSeconds = pmetrics.NewPrometheusGauge(
+	metrics.Registry,
+	prometheus.GaugeOpts{
+		Namespace: pmetrics.Namespace,
+		Subsystem: MetricSubsystem,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "The unix timestamp of the last successful run of a singleton. e.g. Alarm := time() - last_success_timestamp_seconds > 2 * interval",
+	},
+	[]string{MetricLabelController},
+)
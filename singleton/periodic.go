@@ -0,0 +1,190 @@
+package singleton
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/samber/lo"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// ConcurrencyPolicy determines what happens to a scheduled run when the previous run is still in progress
+type ConcurrencyPolicy string
+
+const (
+	// SkipIfRunning drops runs that are scheduled while a run is in progress
+	SkipIfRunning ConcurrencyPolicy = "SkipIfRunning"
+	// QueueOneBehind queues a single run behind the run in progress and drops any others
+	QueueOneBehind ConcurrencyPolicy = "QueueOneBehind"
+)
+
+// PeriodicOption configures periodic runners
+type PeriodicOption struct {
+	// Jitter delays every periodic run by a random duration up to the jitter, without shifting the schedule of later runs
+	Jitter            time.Duration
+	ConcurrencyPolicy ConcurrencyPolicy
+	Clock             clock.Clock
+}
+
+func WithJitter(jitter time.Duration) func(*PeriodicOption) {
+	return func(o *PeriodicOption) {
+		o.Jitter = jitter
+	}
+}
+
+func WithConcurrencyPolicy(policy ConcurrencyPolicy) func(*PeriodicOption) {
+	return func(o *PeriodicOption) {
+		o.ConcurrencyPolicy = policy
+	}
+}
+
+func WithPeriodicClock(clk clock.Clock) func(*PeriodicOption) {
+	return func(o *PeriodicOption) {
+		o.Clock = clk
+	}
+}
+
+// Periodic runs a singleton reconciler on a declared interval. Unlike Source, the cadence doesn't depend on the
+// reconciler returning RequeueAfter: runs are anchored to the time the runner started, so failed or slow runs
+// don't cause the schedule to drift. The results of the reconciler are ignored, other than its error.
+//
+// Periodic is a leader election runnable, so it only runs on the elected leader.
+type Periodic struct {
+	name        string
+	reconciler  Reconciler
+	interval    time.Duration
+	jitter      time.Duration
+	policy      ConcurrencyPolicy
+	clock       clock.Clock
+	lastSuccess atomic.Pointer[time.Time]
+}
+
+// NewPeriodic returns an error if the interval isn't positive, the jitter isn't shorter than the interval, or the
+// concurrency policy is unknown
+func NewPeriodic(name string, reconciler Reconciler, interval time.Duration, opts ...option.Function[PeriodicOption]) (*Periodic, error) {
+	options := option.Resolve(opts...)
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", interval)
+	}
+	// Jitter that reaches the next tick would make every tick look like it was missed
+	if options.Jitter < 0 || options.Jitter >= interval {
+		return nil, fmt.Errorf("jitter must be at least zero and less than the interval %s, got %s", interval, options.Jitter)
+	}
+	policy := lo.Ternary(options.ConcurrencyPolicy == "", SkipIfRunning, options.ConcurrencyPolicy)
+	if policy != SkipIfRunning && policy != QueueOneBehind {
+		return nil, fmt.Errorf("unknown concurrency policy %q", policy)
+	}
+	return &Periodic{
+		name:       name,
+		reconciler: reconciler,
+		interval:   interval,
+		jitter:     options.Jitter,
+		policy:     policy,
+		clock:      lo.Ternary[clock.Clock](options.Clock == nil, clock.RealClock{}, options.Clock),
+	}, nil
+}
+
+func (p *Periodic) Register(_ context.Context, m manager.Manager) error {
+	return m.Add(p)
+}
+
+// NeedLeaderElection ensures that the manager only starts the runner on the leader
+func (p *Periodic) NeedLeaderElection() bool {
+	return true
+}
+
+// LastSuccess returns the time of the last successful run, or the zero time if no run has succeeded yet
+func (p *Periodic) LastSuccess() time.Time {
+	if t := p.lastSuccess.Load(); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
+
+// Start runs the reconciler until the context is cancelled, and waits for the run in progress to finish
+func (p *Periodic) Start(ctx context.Context) error {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues(MetricLabelController, p.name))
+	// The buffer holds the next run, which is either dropped or queued if a run is still in progress
+	runs := make(chan time.Time, 1)
+	running := atomic.Bool{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for scheduled := range runs {
+			running.Store(true)
+			p.run(ctx, scheduled)
+			running.Store(false)
+		}
+	}()
+	defer func() {
+		close(runs)
+		<-done
+	}()
+
+	start := p.clock.Now()
+	for tick := 0; ; tick++ {
+		scheduled := start.Add(time.Duration(tick)*p.interval + p.jitterDelay())
+		if !p.waitUntil(ctx, scheduled) {
+			return nil
+		}
+		// If the schedule fell behind, e.g. because the process was suspended, skip to the most recent tick rather
+		// than bursting through every tick that was missed
+		if latest := int(p.clock.Since(start) / p.interval); latest > tick {
+			MissedTicksTotal.Add(float64(latest-tick), map[string]string{MetricLabelController: p.name})
+			tick = latest
+			scheduled = start.Add(time.Duration(tick) * p.interval)
+		}
+		if p.policy == SkipIfRunning && running.Load() {
+			MissedTicksTotal.Inc(map[string]string{MetricLabelController: p.name})
+			continue
+		}
+		select {
+		case runs <- scheduled:
+		default:
+			MissedTicksTotal.Inc(map[string]string{MetricLabelController: p.name})
+		}
+	}
+}
+
+func (p *Periodic) run(ctx context.Context, scheduled time.Time) {
+	TickDelay.Observe(p.clock.Since(scheduled).Seconds(), map[string]string{MetricLabelController: p.name})
+	if _, err := p.reconciler.Reconcile(ctx); err != nil {
+		if ctx.Err() == nil {
+			serrors.NewLogger(log.FromContext(ctx)).Error(serrors.ObserveError(err, MetricLabelController, p.name), "singleton reconciler failed")
+		}
+		return
+	}
+	now := p.clock.Now()
+	p.lastSuccess.Store(&now)
+	LastSuccessTimestampSeconds.Set(float64(now.Unix()), map[string]string{MetricLabelController: p.name})
+}
+
+func (p *Periodic) jitterDelay() time.Duration {
+	if p.jitter <= 0 {
+		return 0
+	}
+	return rand.N(p.jitter)
+}
+
+// waitUntil blocks until the clock reaches t, returning false if the context is cancelled first
+func (p *Periodic) waitUntil(ctx context.Context, t time.Time) bool {
+	d := t.Sub(p.clock.Now())
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := p.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
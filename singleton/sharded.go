@@ -0,0 +1,237 @@
+package singleton
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"time"
+
+	opcontext "github.com/awslabs/operatorpkg/context"
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/awslabs/operatorpkg/reconciler"
+	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/samber/lo"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// ShardGroupLabel is the label on membership leases that identifies the sharded singleton they belong to
+const ShardGroupLabel = "operatorpkg.k8s.aws/shard-group"
+
+// Shard is the portion of the work key hash space assigned to a replica. Replicas are sorted by identity and
+// each one owns an equal, contiguous range of the 64 bit FNV-1a hash space.
+type Shard struct {
+	Index   int
+	Count   int
+	Members []string
+}
+
+// Owns returns true if the key hashes into the range of the shard. A nil shard owns every key.
+func (s *Shard) Owns(key string) bool {
+	if s == nil || s.Count <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	width := math.MaxUint64 / uint64(s.Count)
+	// The last shard also owns the remainder of the division
+	return min(h.Sum64()/width, uint64(s.Count-1)) == uint64(s.Index)
+}
+
+// ShardFromContext returns the shard assigned to the reconciler, or nil if the reconciler isn't sharded
+func ShardFromContext(ctx context.Context) *Shard {
+	return opcontext.From[Shard](ctx)
+}
+
+// ShardedOption configures sharded runners
+type ShardedOption struct {
+	// LeaseDuration is the duration of the membership leases. Defaults to 15 seconds
+	LeaseDuration time.Duration
+	// Periodic configures the periodic runner that runs the reconciler on each replica
+	Periodic []option.Function[PeriodicOption]
+}
+
+func WithLeaseDuration(leaseDuration time.Duration) func(*ShardedOption) {
+	return func(o *ShardedOption) {
+		o.LeaseDuration = leaseDuration
+	}
+}
+
+func WithPeriodicOptions(opts ...option.Function[PeriodicOption]) func(*ShardedOption) {
+	return func(o *ShardedOption) {
+		o.Periodic = append(o.Periodic, opts...)
+	}
+}
+
+// Sharded runs a singleton reconciler on an interval on every replica rather than only on the leader. Each replica
+// announces its membership with a coordination.k8s.io Lease, and the work key hash space is split between the
+// replicas that hold unexpired leases. Membership is recomputed before every run, so shards rebalance automatically
+// as replicas come and go. During rebalancing, replicas may briefly disagree on the membership, so reconcilers must
+// tolerate a key being processed by two replicas, or by none for a run.
+//
+// Reconcilers retrieve their assignment with ShardFromContext. The replica requires permissions to get, list,
+// create, update and delete leases in the namespace, and the client should not be backed by a cache.
+type Sharded struct {
+	*Periodic
+	name          string
+	namespace     string
+	identity      string
+	kubeClient    client.Client
+	leaseDuration time.Duration
+	clock         clock.Clock
+}
+
+// NewSharded returns an error if the lease duration is shorter than a second, since leases are renewed in whole
+// seconds, or if the options of the periodic runner are invalid, see NewPeriodic
+func NewSharded(name, namespace, identity string, kubeClient client.Client, rec Reconciler, interval time.Duration, opts ...option.Function[ShardedOption]) (*Sharded, error) {
+	options := option.Resolve(opts...)
+	if options.LeaseDuration < 0 || (options.LeaseDuration > 0 && options.LeaseDuration < time.Second) {
+		return nil, fmt.Errorf("lease duration must be at least 1s, got %s", options.LeaseDuration)
+	}
+	// Leases are renewed and expired with the clock of the periodic runner
+	periodicOptions := option.Resolve(options.Periodic...)
+	s := &Sharded{
+		name:          name,
+		namespace:     namespace,
+		identity:      identity,
+		kubeClient:    kubeClient,
+		leaseDuration: lo.Ternary(options.LeaseDuration == 0, 15*time.Second, options.LeaseDuration),
+		clock:         lo.Ternary[clock.Clock](periodicOptions.Clock == nil, clock.RealClock{}, periodicOptions.Clock),
+	}
+	periodic, err := NewPeriodic(name, reconcilerFunc(func(ctx context.Context) (reconciler.Result, error) {
+		shard, err := s.assignment(ctx)
+		if err != nil {
+			return reconciler.Result{}, err
+		}
+		return rec.Reconcile(opcontext.Into(ctx, shard))
+	}), interval, options.Periodic...)
+	if err != nil {
+		return nil, err
+	}
+	s.Periodic = periodic
+	return s, nil
+}
+
+func (s *Sharded) Register(_ context.Context, m manager.Manager) error {
+	return m.Add(s)
+}
+
+// NeedLeaderElection allows the manager to start the runner on every replica
+func (s *Sharded) NeedLeaderElection() bool {
+	return false
+}
+
+// Start announces the membership of the replica and runs the reconciler until the context is cancelled. The lease
+// is released on shutdown so that the remaining replicas rebalance without waiting for it to expire.
+func (s *Sharded) Start(ctx context.Context) error {
+	if err := s.renew(ctx); err != nil {
+		return fmt.Errorf("creating membership lease, %w", err)
+	}
+	heartbeat, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for s.waitFor(heartbeat, s.leaseDuration/3) {
+			if err := s.renew(heartbeat); err != nil && heartbeat.Err() == nil {
+				serrors.NewLogger(log.FromContext(ctx)).Error(serrors.ObserveError(err, MetricLabelController, s.name), "failed renewing membership lease")
+			}
+		}
+	}()
+	err := s.Periodic.Start(ctx)
+	// Wait for the heartbeat to stop so that an in-flight renewal can't recreate the released lease
+	cancel()
+	<-stopped
+	// The manager's context is cancelled by now, so release the lease with a fresh one
+	release, done := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer done()
+	if deleteErr := client.IgnoreNotFound(s.kubeClient.Delete(release, s.lease())); deleteErr != nil {
+		serrors.NewLogger(log.FromContext(ctx)).Error(serrors.ObserveError(deleteErr, MetricLabelController, s.name), "failed releasing membership lease")
+	}
+	return err
+}
+
+func (s *Sharded) lease() *coordinationv1.Lease {
+	// Identities such as <hostname>_<uuid> aren't valid object names, so the lease is named by a hash of the identity,
+	// which is recorded as the holder of the lease
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s.identity))
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%016x", s.name, h.Sum64()),
+			Namespace: s.namespace,
+			Labels:    map[string]string{ShardGroupLabel: s.name},
+		},
+	}
+}
+
+// renew creates or renews the membership lease of this replica
+func (s *Sharded) renew(ctx context.Context) error {
+	lease := s.lease()
+	if err := s.kubeClient.Get(ctx, client.ObjectKeyFromObject(lease), lease); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		lease.Spec = s.leaseSpec()
+		lease.Spec.AcquireTime = lease.Spec.RenewTime
+		return s.kubeClient.Create(ctx, lease)
+	}
+	stored := lease.DeepCopy()
+	lease.Spec = s.leaseSpec()
+	lease.Spec.AcquireTime = stored.Spec.AcquireTime
+	return s.kubeClient.Patch(ctx, lease, client.MergeFrom(stored))
+}
+
+func (s *Sharded) leaseSpec() coordinationv1.LeaseSpec {
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       lo.ToPtr(s.identity),
+		LeaseDurationSeconds: lo.ToPtr(int32(s.leaseDuration.Seconds())),
+		RenewTime:            lo.ToPtr(metav1.NewMicroTime(s.clock.Now())),
+	}
+}
+
+// assignment computes the shard of this replica from the unexpired membership leases
+func (s *Sharded) assignment(ctx context.Context) (*Shard, error) {
+	leases := &coordinationv1.LeaseList{}
+	if err := s.kubeClient.List(ctx, leases, client.InNamespace(s.namespace), client.MatchingLabels{ShardGroupLabel: s.name}); err != nil {
+		return nil, fmt.Errorf("listing membership leases, %w", err)
+	}
+	members := []string{s.identity}
+	for _, lease := range leases.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		if lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).Before(s.clock.Now()) {
+			continue
+		}
+		members = append(members, *lease.Spec.HolderIdentity)
+	}
+	slices.Sort(members)
+	members = slices.Compact(members)
+	return &Shard{Index: slices.Index(members, s.identity), Count: len(members), Members: members}, nil
+}
+
+// waitFor blocks for the duration, returning false if the context is cancelled first
+func (s *Sharded) waitFor(ctx context.Context, d time.Duration) bool {
+	timer := s.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
+
+type reconcilerFunc func(context.Context) (reconciler.Result, error)
+
+func (f reconcilerFunc) Reconcile(ctx context.Context) (reconciler.Result, error) {
+	return f(ctx)
+}
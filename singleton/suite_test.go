@@ -0,0 +1,475 @@
+package singleton_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/awslabs/operatorpkg/reconciler"
+	"github.com/awslabs/operatorpkg/serrors"
+	"github.com/awslabs/operatorpkg/singleton"
+	. "github.com/awslabs/operatorpkg/test/expectations"
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	clock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var ctx context.Context
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Singleton")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = log.IntoContext(context.Background(), ginkgo.GinkgoLogr)
+})
+
+// MockReconciler counts its runs and blocks each run until it is released, if a release channel is set
+type MockReconciler struct {
+	runs    atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (m *MockReconciler) Reconcile(ctx context.Context) (reconciler.Result, error) {
+	m.runs.Add(1)
+	if m.release != nil {
+		select {
+		case <-m.release:
+		case <-ctx.Done():
+		}
+	}
+	return reconciler.Result{}, m.err
+}
+
+func (m *MockReconciler) Runs() int {
+	return int(m.runs.Load())
+}
+
+// MockQueue records the requests added to it
+type MockQueue struct {
+	workqueue.TypedRateLimitingInterface[reconcile.Request]
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (m *MockQueue) Add(_ reconcile.Request) {
+	m.AddAfter(reconcile.Request{}, 0)
+}
+
+func (m *MockQueue) AddAfter(_ reconcile.Request, after time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delays = append(m.delays, after)
+}
+
+func (m *MockQueue) Delays() []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration{}, m.delays...)
+}
+
+// ShardRecorder records the shard that it was last reconciled with
+type ShardRecorder struct {
+	shard atomic.Pointer[singleton.Shard]
+}
+
+func (s *ShardRecorder) Reconcile(ctx context.Context) (reconciler.Result, error) {
+	s.shard.Store(singleton.ShardFromContext(ctx))
+	return reconciler.Result{}, nil
+}
+
+func (s *ShardRecorder) Shard() *singleton.Shard {
+	return s.shard.Load()
+}
+
+// start runs the runnable in the background and stops it when the test ends
+func start(runnable interface{ Start(context.Context) error }) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		defer close(done)
+		Expect(runnable.Start(ctx)).To(Succeed())
+	}()
+	DeferCleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+var _ = Describe("Singleton", func() {
+	var fakeClock *clock.FakeClock
+
+	BeforeEach(func() {
+		fakeClock = clock.NewFakeClock(time.Now())
+		singleton.MissedTicksTotal.Reset()
+		singleton.LastSuccessTimestampSeconds.Reset()
+	})
+	Context("Periodic", func() {
+		It("should run immediately and then on every interval", func() {
+			rec := &MockReconciler{}
+			periodic := lo.Must(singleton.NewPeriodic("test", rec, time.Minute, singleton.WithPeriodicClock(fakeClock)))
+			start(periodic)
+
+			Eventually(rec.Runs).Should(Equal(1))
+			for i := 2; i <= 5; i++ {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				fakeClock.Step(time.Minute)
+				Eventually(rec.Runs).Should(Equal(i))
+			}
+			Eventually(periodic.LastSuccess).Should(Equal(fakeClock.Now()))
+			Expect(GetMetric("operator_singleton_last_success_timestamp_seconds", map[string]string{singleton.MetricLabelController: "test"}).GetGauge().GetValue()).
+				To(BeEquivalentTo(fakeClock.Now().Unix()))
+		})
+		It("should keep its cadence when the reconciler fails", func() {
+			rec := &MockReconciler{err: errors.New("test error")}
+			periodic := lo.Must(singleton.NewPeriodic("test", rec, time.Minute, singleton.WithPeriodicClock(fakeClock)))
+			start(periodic)
+
+			Eventually(rec.Runs).Should(Equal(1))
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(time.Minute)
+			Eventually(rec.Runs).Should(Equal(2))
+			Expect(periodic.LastSuccess()).To(BeZero())
+		})
+		It("should count failed runs with the name of the runner", func() {
+			registry := prometheus.NewRegistry()
+			serrors.EnableMetrics(registry, singleton.MetricLabelController)
+			DeferCleanup(serrors.DisableMetrics)
+			rec := &MockReconciler{err: errors.New("test error")}
+			start(lo.Must(singleton.NewPeriodic("test", rec, time.Minute, singleton.WithPeriodicClock(fakeClock))))
+
+			Eventually(rec.Runs).Should(Equal(1))
+			Eventually(func(g Gomega) {
+				families, err := registry.Gather()
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(families).To(HaveLen(1))
+				g.Expect(families[0].GetMetric()).To(HaveLen(1))
+				g.Expect(families[0].GetMetric()[0].GetCounter().GetValue()).To(BeEquivalentTo(1))
+				g.Expect(families[0].GetMetric()[0].GetLabel()).To(ContainElement(HaveField("GetValue()", "test")))
+			}).Should(Succeed())
+		})
+		It("should skip ticks while a run is in progress", func() {
+			rec := &MockReconciler{release: make(chan struct{})}
+			periodic := lo.Must(singleton.NewPeriodic("test", rec, time.Minute, singleton.WithPeriodicClock(fakeClock), singleton.WithConcurrencyPolicy(singleton.SkipIfRunning)))
+			start(periodic)
+
+			Eventually(rec.Runs).Should(Equal(1))
+			for range 3 {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				fakeClock.Step(time.Minute)
+			}
+			Eventually(func() float64 {
+				return GetMetric("operator_singleton_missed_ticks_total", map[string]string{singleton.MetricLabelController: "test"}).GetCounter().GetValue()
+			}).Should(BeEquivalentTo(3))
+			rec.release <- struct{}{}
+			Consistently(rec.Runs).Should(Equal(1))
+		})
+		It("should queue a single run behind the run in progress", func() {
+			rec := &MockReconciler{release: make(chan struct{})}
+			periodic := lo.Must(singleton.NewPeriodic("test", rec, time.Minute, singleton.WithPeriodicClock(fakeClock), singleton.WithConcurrencyPolicy(singleton.QueueOneBehind)))
+			start(periodic)
+
+			Eventually(rec.Runs).Should(Equal(1))
+			for range 3 {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				fakeClock.Step(time.Minute)
+			}
+			Eventually(func() float64 {
+				return GetMetric("operator_singleton_missed_ticks_total", map[string]string{singleton.MetricLabelController: "test"}).GetCounter().GetValue()
+			}).Should(BeEquivalentTo(2))
+			rec.release <- struct{}{}
+			Eventually(rec.Runs).Should(Equal(2))
+			rec.release <- struct{}{}
+			Consistently(rec.Runs).Should(Equal(2))
+		})
+		It("should skip to the latest tick when the schedule falls behind", func() {
+			rec := &MockReconciler{}
+			periodic := lo.Must(singleton.NewPeriodic("test", rec, time.Minute, singleton.WithPeriodicClock(fakeClock)))
+			start(periodic)
+
+			Eventually(rec.Runs).Should(Equal(1))
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(10 * time.Minute)
+			Eventually(rec.Runs).Should(Equal(2))
+			Eventually(func() float64 {
+				return GetMetric("operator_singleton_missed_ticks_total", map[string]string{singleton.MetricLabelController: "test"}).GetCounter().GetValue()
+			}).Should(BeEquivalentTo(9))
+			Consistently(rec.Runs).Should(Equal(2))
+		})
+		DescribeTable("should reject invalid options",
+			func(interval time.Duration, opts ...option.Function[singleton.PeriodicOption]) {
+				_, err := singleton.NewPeriodic("test", &MockReconciler{}, interval, opts...)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("zero interval", time.Duration(0)),
+			Entry("negative interval", -time.Minute),
+			Entry("negative jitter", time.Minute, singleton.WithJitter(-time.Second)),
+			Entry("jitter as long as the interval", time.Minute, singleton.WithJitter(time.Minute)),
+			Entry("unknown concurrency policy", time.Minute, singleton.WithConcurrencyPolicy("Unknown")),
+		)
+	})
+	Context("Cron", func() {
+		DescribeTable("should compute the next fire time",
+			func(spec string, from string, expected string) {
+				schedule, err := singleton.ParseSchedule(spec, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(schedule.Next(lo.Must(time.Parse(time.RFC3339, from))).Format(time.RFC3339)).To(Equal(expected))
+			},
+			Entry("every minute", "* * * * *", "2026-01-01T00:00:30Z", "2026-01-01T00:01:00Z"),
+			Entry("fixed time", "30 2 * * *", "2026-01-01T03:00:00Z", "2026-01-02T02:30:00Z"),
+			Entry("steps", "*/15 * * * *", "2026-01-01T00:16:00Z", "2026-01-01T00:30:00Z"),
+			Entry("ranges with steps", "0 8-18/4 * * *", "2026-01-01T12:00:00Z", "2026-01-01T16:00:00Z"),
+			Entry("lists", "0 0 1,15 * *", "2026-01-02T00:00:00Z", "2026-01-15T00:00:00Z"),
+			Entry("month names", "0 0 1 mar *", "2026-01-01T00:00:00Z", "2026-03-01T00:00:00Z"),
+			Entry("weekday names", "0 9 * * mon-fri", "2026-01-03T10:00:00Z", "2026-01-05T09:00:00Z"),
+			Entry("sunday as 7", "0 0 * * 7", "2026-01-01T00:00:00Z", "2026-01-04T00:00:00Z"),
+			Entry("day of month or day of week", "0 0 13 * fri", "2026-01-01T00:00:00Z", "2026-01-02T00:00:00Z"),
+			Entry("descriptors", "@monthly", "2026-01-15T00:00:00Z", "2026-02-01T00:00:00Z"),
+			Entry("leap days", "0 0 29 2 *", "2026-01-01T00:00:00Z", "2028-02-29T00:00:00Z"),
+			Entry("end of year", "0 0 1 1 *", "2026-12-31T23:59:00Z", "2027-01-01T00:00:00Z"),
+			Entry("time zones", "CRON_TZ=America/New_York 0 2 * * *", "2026-01-01T00:00:00Z", "2026-01-01T07:00:00Z"),
+		)
+		It("should evaluate schedules in the configured location", func() {
+			schedule, err := singleton.ParseSchedule("0 2 * * *", lo.Must(time.LoadLocation("Asia/Kolkata")))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(lo.Must(time.Parse(time.RFC3339, "2026-01-01T00:00:00Z"))).UTC().Format(time.RFC3339)).To(Equal("2026-01-01T20:30:00Z"))
+		})
+		It("should never fire for impossible dates", func() {
+			schedule, err := singleton.ParseSchedule("0 0 30 2 *", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(time.Now())).To(BeZero())
+		})
+		DescribeTable("should reject invalid schedules",
+			func(spec string) {
+				_, err := singleton.ParseSchedule(spec, nil)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("too few fields", "* * * *"),
+			Entry("out of range", "60 * * * *"),
+			Entry("inverted range", "0 5-1 * * *"),
+			Entry("zero step", "*/0 * * * *"),
+			Entry("unknown name", "0 0 * foo *"),
+			Entry("unknown time zone", "CRON_TZ=Nowhere/Special 0 0 * * *"),
+		)
+		It("should only run the reconciler at the fire times", func() {
+			fakeClock.SetTime(lo.Must(time.Parse(time.RFC3339, "2026-01-01T00:00:30Z")))
+			rec := &MockReconciler{}
+			cron, err := singleton.NewCronReconciler("test", "*/5 * * * *", rec, singleton.WithCronClock(fakeClock))
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := cron.Reconcile(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(4*time.Minute + 30*time.Second))
+			Expect(rec.Runs()).To(Equal(0))
+
+			fakeClock.Step(4*time.Minute + 30*time.Second)
+			result, err = cron.Reconcile(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+			Expect(rec.Runs()).To(Equal(1))
+			Expect(GetMetric("operator_singleton_last_success_timestamp_seconds", map[string]string{singleton.MetricLabelController: "test"}).GetGauge().GetValue()).
+				To(BeEquivalentTo(fakeClock.Now().Unix()))
+		})
+		It("should retry a failed run until it succeeds", func() {
+			fakeClock.SetTime(lo.Must(time.Parse(time.RFC3339, "2026-01-01T00:04:00Z")))
+			rec := &MockReconciler{err: errors.New("test error")}
+			cron, err := singleton.NewCronReconciler("test", "*/5 * * * *", rec, singleton.WithCronClock(fakeClock))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cron.Reconcile(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeClock.Step(time.Minute)
+			_, err = cron.Reconcile(ctx)
+			Expect(err).To(HaveOccurred())
+			rec.err = nil
+			fakeClock.Step(time.Second)
+			result, err := cron.Reconcile(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rec.Runs()).To(Equal(2))
+			Expect(result.RequeueAfter).To(Equal(4*time.Minute + 59*time.Second))
+		})
+		It("should catch up on a run that was missed before it started", func() {
+			fakeClock.SetTime(lo.Must(time.Parse(time.RFC3339, "2026-01-01T00:12:00Z")))
+			rec := &MockReconciler{}
+			lastSuccess := func(context.Context) (time.Time, error) {
+				return lo.Must(time.Parse(time.RFC3339, "2026-01-01T00:00:00Z")), nil
+			}
+			cron, err := singleton.NewCronReconciler("test", "*/5 * * * *", rec, singleton.WithCronClock(fakeClock), singleton.WithLastSuccess(lastSuccess))
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := cron.Reconcile(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rec.Runs()).To(Equal(1))
+			Expect(result.RequeueAfter).To(Equal(3 * time.Minute))
+		})
+		It("should wait for the next fire time when it has never succeeded", func() {
+			fakeClock.SetTime(lo.Must(time.Parse(time.RFC3339, "2026-01-01T00:12:00Z")))
+			rec := &MockReconciler{}
+			lastSuccess := func(context.Context) (time.Time, error) { return time.Time{}, nil }
+			cron, err := singleton.NewCronReconciler("test", "*/5 * * * *", rec, singleton.WithCronClock(fakeClock), singleton.WithLastSuccess(lastSuccess))
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := cron.Reconcile(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rec.Runs()).To(Equal(0))
+			Expect(result.RequeueAfter).To(Equal(3 * time.Minute))
+		})
+		It("should return the error of the last success", func() {
+			lastSuccess := func(context.Context) (time.Time, error) { return time.Time{}, errors.New("test error") }
+			cron, err := singleton.NewCronReconciler("test", "*/5 * * * *", &MockReconciler{}, singleton.WithCronClock(fakeClock), singleton.WithLastSuccess(lastSuccess))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cron.Reconcile(ctx)
+			Expect(err).To(MatchError(ContainSubstring("test error")))
+		})
+	})
+	Context("Trigger", func() {
+		var queue *MockQueue
+		var sourceCtx context.Context
+
+		BeforeEach(func() {
+			queue = &MockQueue{}
+			var cancel context.CancelFunc
+			sourceCtx, cancel = context.WithCancel(ctx)
+			DeferCleanup(cancel)
+		})
+		It("should enqueue a run when triggered", func() {
+			trigger := singleton.NewTrigger(singleton.WithTriggerClock(fakeClock))
+			Expect(trigger.Source().Start(sourceCtx, queue)).To(Succeed())
+
+			trigger.Trigger()
+			Eventually(queue.Delays).Should(HaveExactElements(time.Duration(0)))
+			trigger.Trigger()
+			Eventually(queue.Delays).Should(HaveExactElements(time.Duration(0), time.Duration(0)))
+		})
+		It("should debounce bursts of triggers", func() {
+			trigger := singleton.NewTrigger(singleton.WithTriggerClock(fakeClock), singleton.WithMinInterval(10*time.Second))
+			Expect(trigger.Source().Start(sourceCtx, queue)).To(Succeed())
+
+			trigger.Trigger()
+			Eventually(queue.Delays).Should(HaveLen(1))
+			fakeClock.Step(time.Second)
+			for range 10 {
+				trigger.Trigger()
+			}
+			Eventually(queue.Delays).Should(HaveExactElements(time.Duration(0), 9*time.Second))
+			Consistently(queue.Delays).Should(HaveLen(2))
+
+			fakeClock.Step(30 * time.Second)
+			trigger.Trigger()
+			Eventually(queue.Delays).Should(HaveExactElements(time.Duration(0), 9*time.Second, time.Duration(0)))
+		})
+	})
+	Context("Sharded", func() {
+		var kubeClient client.Client
+
+		BeforeEach(func() {
+			kubeClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		})
+		It("should assign every key to exactly one shard", func() {
+			for count := 1; count <= 5; count++ {
+				for i := range 100 {
+					key := fmt.Sprintf("key-%d", i)
+					owners := lo.Filter(lo.Range(count), func(index int, _ int) bool {
+						return (&singleton.Shard{Index: index, Count: count}).Owns(key)
+					})
+					Expect(owners).To(HaveLen(1))
+				}
+			}
+			Expect((*singleton.Shard)(nil).Owns("key")).To(BeTrue())
+		})
+		It("should split the work between replicas and rebalance when a replica leaves", func() {
+			recs := map[string]*ShardRecorder{}
+			cancels := map[string]context.CancelFunc{}
+			dones := map[string]chan struct{}{}
+			for _, identity := range []string{"a", "b"} {
+				recs[identity] = &ShardRecorder{}
+				sharded := lo.Must(singleton.NewSharded("test", "default", identity, kubeClient, recs[identity], time.Minute, singleton.WithPeriodicOptions(singleton.WithPeriodicClock(fakeClock)), singleton.WithLeaseDuration(time.Hour)))
+				replicaCtx, cancel := context.WithCancel(ctx)
+				done := make(chan struct{})
+				cancels[identity], dones[identity] = cancel, done
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					Expect(sharded.Start(replicaCtx)).To(Succeed())
+				}()
+				DeferCleanup(cancel)
+			}
+			Eventually(func(g Gomega) {
+				g.Expect(recs["a"].Shard()).ToNot(BeNil())
+				g.Expect(recs["b"].Shard()).ToNot(BeNil())
+			}).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				fakeClock.Step(time.Minute)
+				g.Expect(recs["a"].Shard()).To(Equal(&singleton.Shard{Index: 0, Count: 2, Members: []string{"a", "b"}}))
+				g.Expect(recs["b"].Shard()).To(Equal(&singleton.Shard{Index: 1, Count: 2, Members: []string{"a", "b"}}))
+			}).Should(Succeed())
+
+			// Stopping a replica releases its lease
+			cancels["b"]()
+			<-dones["b"]
+			leases := &coordinationv1.LeaseList{}
+			Expect(kubeClient.List(ctx, leases)).To(Succeed())
+			Expect(leases.Items).To(HaveLen(1))
+
+			Eventually(func(g Gomega) {
+				fakeClock.Step(time.Minute)
+				g.Expect(recs["a"].Shard()).To(Equal(&singleton.Shard{Index: 0, Count: 1, Members: []string{"a"}}))
+			}).Should(Succeed())
+		})
+		It("should ignore expired membership leases", func() {
+			Expect(kubeClient.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-stale", Namespace: "default", Labels: map[string]string{singleton.ShardGroupLabel: "test"}},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity:       lo.ToPtr("stale"),
+					LeaseDurationSeconds: lo.ToPtr(int32(15)),
+					RenewTime:            lo.ToPtr(metav1.NewMicroTime(fakeClock.Now().Add(-time.Minute))),
+				},
+			})).To(Succeed())
+			rec := &ShardRecorder{}
+			start(lo.Must(singleton.NewSharded("test", "default", "a", kubeClient, rec, time.Minute, singleton.WithPeriodicOptions(singleton.WithPeriodicClock(fakeClock)))))
+
+			Eventually(rec.Shard).Should(Equal(&singleton.Shard{Index: 0, Count: 1, Members: []string{"a"}}))
+		})
+		It("should name membership leases validly for any identity", func() {
+			identity := "ip-10-0-0-1.ec2.internal_0d6b5d6e-2c4a-4c8e-9d8a-0b1f1e2d3c4b"
+			rec := &ShardRecorder{}
+			start(lo.Must(singleton.NewSharded("test", "default", identity, kubeClient, rec, time.Minute, singleton.WithPeriodicOptions(singleton.WithPeriodicClock(fakeClock)))))
+
+			Eventually(rec.Shard).Should(Equal(&singleton.Shard{Index: 0, Count: 1, Members: []string{identity}}))
+			leases := &coordinationv1.LeaseList{}
+			Expect(kubeClient.List(ctx, leases)).To(Succeed())
+			Expect(leases.Items).To(HaveLen(1))
+			Expect(validation.IsDNS1123Subdomain(leases.Items[0].Name)).To(BeEmpty())
+			Expect(leases.Items[0].Spec.HolderIdentity).To(Equal(lo.ToPtr(identity)))
+		})
+		DescribeTable("should reject lease durations shorter than a second",
+			func(leaseDuration time.Duration) {
+				_, err := singleton.NewSharded("test", "default", "a", kubeClient, &ShardRecorder{}, time.Minute, singleton.WithLeaseDuration(leaseDuration))
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("negative", -time.Second),
+			Entry("sub-second", 500*time.Millisecond),
+		)
+	})
+})
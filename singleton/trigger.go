@@ -0,0 +1,101 @@
+package singleton
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/awslabs/operatorpkg/option"
+	"github.com/samber/lo"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// TriggerOption configures triggers
+type TriggerOption struct {
+	// MinInterval is the minimum amount of time between runs enqueued by the trigger
+	MinInterval time.Duration
+	// Priority is the priority of triggered requests when the controller uses a priority queue
+	Priority *int
+	Clock    clock.Clock
+}
+
+func WithMinInterval(minInterval time.Duration) func(*TriggerOption) {
+	return func(o *TriggerOption) {
+		o.MinInterval = minInterval
+	}
+}
+
+func WithTriggerPriority(priority int) func(*TriggerOption) {
+	return func(o *TriggerOption) {
+		o.Priority = &priority
+	}
+}
+
+func WithTriggerClock(clk clock.Clock) func(*TriggerOption) {
+	return func(o *TriggerOption) {
+		o.Clock = clk
+	}
+}
+
+// Trigger is a handle that other controllers or HTTP handlers can use to request an immediate run of a singleton
+// controller, e.g. to rerun capacity planning when a NodePool changes. Triggers are coalesced while a run is pending,
+// and bursts of triggers are debounced so that runs are enqueued at most once per minimum interval.
+//
+// Watch the trigger's Source alongside singleton.Source when registering the controller.
+type Trigger struct {
+	events      chan event.GenericEvent
+	minInterval time.Duration
+	priority    *int
+	clock       clock.Clock
+
+	mu        sync.Mutex
+	scheduled time.Time
+}
+
+func NewTrigger(opts ...option.Function[TriggerOption]) *Trigger {
+	options := option.Resolve(opts...)
+	return &Trigger{
+		events:      make(chan event.GenericEvent, 1),
+		minInterval: options.MinInterval,
+		priority:    options.Priority,
+		clock:       lo.Ternary[clock.Clock](options.Clock == nil, clock.RealClock{}, options.Clock),
+	}
+}
+
+// Trigger requests a run of the singleton. It never blocks, and is safe to call concurrently.
+func (t *Trigger) Trigger() {
+	select {
+	case t.events <- event.GenericEvent{}:
+	default: // A trigger is already pending, so this one is coalesced into it
+	}
+}
+
+// Source creates a source that enqueues the singleton whenever it's triggered
+func (t *Trigger) Source() source.Source {
+	return source.Channel(t.events, handler.Funcs{
+		GenericFunc: func(_ context.Context, _ event.GenericEvent, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if delay, ok := t.debounce(); ok {
+				enqueue(queue, delay, t.priority)
+			}
+		},
+	})
+}
+
+// debounce returns how long to delay a triggered run to respect the minimum interval, or false if a delayed run
+// is already scheduled and the trigger can be dropped
+func (t *Trigger) debounce() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	if t.scheduled.After(now) {
+		return 0, false
+	}
+	delay := max(0, t.scheduled.Add(t.minInterval).Sub(now))
+	t.scheduled = now.Add(delay)
+	return delay, true
+}